@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/simulation"
+)
+
+func main() {
+	var cfg simulation.Config
+	flag.StringVar(&cfg.BaseURL, "url", "", "API under test; empty runs against a local fake server")
+	flag.IntVar(&cfg.Workers, "workers", 200, "number of simulated workers")
+	flag.IntVar(&cfg.Tasks, "tasks", 2000, "number of generated tasks")
+	flag.Float64Var(&cfg.TaskRate, "rate", 0, "tasks created per second, 0 to create them all upfront")
+	flag.DurationVar(&cfg.TaskDuration, "duration", 100*time.Millisecond, "processing time of a task")
+	flag.DurationVar(&cfg.Jitter, "jitter", 50*time.Millisecond, "random processing time added to each task")
+	flag.Float64Var(&cfg.FailureRate, "failure-rate", 0.05, "share of the tasks failed by the workers")
+	flag.DurationVar(&cfg.PollWait, "poll-wait", 0, "long-poll duration of the claims")
+	flag.DurationVar(&cfg.HeartbeatInterval, "heartbeat", 30*time.Second, "heartbeat interval, 0 to disable")
+	flag.DurationVar(&cfg.Timeout, "timeout", 10*time.Minute, "maximum duration of the run")
+	jsonOutput := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+	cfg.UserToken = os.Getenv("QALPUCH_TOKEN")
+	// Without registration tokens, a worker is created per simulated worker with the user token.
+	if tokens := os.Getenv("QALPUCH_WORKER_TOKENS"); tokens != "" {
+		cfg.RegistrationTokens = strings.Split(tokens, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	report, err := simulation.Run(ctx, cfg)
+	if report == nil {
+		log.Fatalf("Simulation failed: %v", err)
+	}
+	if err != nil {
+		log.Printf("Simulation stopped early: %v", err)
+	}
+	if *jsonOutput {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Println(report)
+}
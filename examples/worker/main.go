@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// copyHandler returns the source file unchanged.
+type copyHandler struct{}
+
+func (copyHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	data, err := os.ReadFile(job.SourcePath)
+	if err != nil {
+		return nil, err
+	}
+	return &worker.Result{Filename: job.Source.Filename, Data: data}, nil
+}
+
+func main() {
+	baseURL := "http://localhost:8080/v1" // Replace with your API base URL
+
+	// The registration token is generated by an administrator with CreateWorker.
+	client := clients.NewClient(baseURL, "")
+	runner := worker.NewRunner(client,
+		worker.WithRegistrationToken(os.Getenv("QALPUCH_WORKER_TOKEN")),
+		worker.WithCredentialsFile(os.Getenv("QALPUCH_WORKER_CREDENTIALS")),
+		worker.WithHandler(models.WorkerTypeImage, copyHandler{}),
+		worker.WithMiddleware(worker.Logging(slog.Default()), worker.Retry(3, nil)),
+		worker.WithShutdownGrace(time.Minute),
+		worker.WithHandBackStatus(models.TaskStatusPending),
+	)
+
+	// Run stops claiming tasks on SIGINT or SIGTERM and drains the running ones.
+	if err := runner.Run(context.Background()); err != nil {
+		log.Fatalf("Worker stopped: %v", err)
+	}
+}
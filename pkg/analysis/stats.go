@@ -0,0 +1,215 @@
+package analysis
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// DurationStats summarizes a set of durations.
+type DurationStats struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"-"`
+	P50   time.Duration `json:"-"`
+	P95   time.Duration `json:"-"`
+}
+
+// MarshalJSON renders durations as seconds.
+func (s DurationStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Count int     `json:"count"`
+		Mean  float64 `json:"meanSeconds"`
+		P50   float64 `json:"p50Seconds"`
+		P95   float64 `json:"p95Seconds"`
+	}{s.Count, s.Mean.Seconds(), s.P50.Seconds(), s.P95.Seconds()})
+}
+
+// NewDurationStats computes the statistics of the given durations.
+func NewDurationStats(durations []time.Duration) DurationStats {
+	s := DurationStats{Count: len(durations)}
+	if len(durations) == 0 {
+		return s
+	}
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	s.Mean = total / time.Duration(len(durations))
+	s.P50 = Percentile(durations, 50)
+	s.P95 = Percentile(durations, 95)
+	return s
+}
+
+// Percentile returns the p-th percentile (0-100) of durations using the nearest-rank method.
+func Percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	rank = min(max(rank, 1), len(sorted))
+	return sorted[rank-1]
+}
+
+// TypeStats aggregates the tasks of one conversion type.
+type TypeStats struct {
+	Type           models.WorkerType `json:"type"`
+	Total          int               `json:"total"`
+	Completed      int               `json:"completed"`
+	Failed         int               `json:"failed"`
+	InFlight       int               `json:"inFlight"`
+	Retries        int               `json:"retries"` // Total retries of the tasks, see Timeline.Retries
+	FailureRate    float64           `json:"failureRate"`
+	Throughput     float64           `json:"throughputPerHour"` // finished tasks per hour over the observed window
+	QueueTime      DurationStats     `json:"queueTime"`
+	ProcessingTime DurationStats     `json:"processingTime"`
+	FailureReasons map[string]int    `json:"failureReasons,omitempty"`
+}
+
+// Report holds the statistics computed over a set of tasks.
+type Report struct {
+	From      time.Time   `json:"from"`
+	To        time.Time   `json:"to"`
+	Timelines []Timeline  `json:"-"`
+	Types     []TypeStats `json:"types"`
+}
+
+// Analyze reconstructs the timeline of every task and aggregates them per conversion type.
+func Analyze(tasks []models.Task) *Report {
+	report := &Report{}
+	type acc struct {
+		stats             TypeStats
+		queue, processing []time.Duration
+		from, to          time.Time
+	}
+	byType := make(map[models.WorkerType]*acc)
+
+	for _, task := range tasks {
+		tl := NewTimeline(task)
+		report.Timelines = append(report.Timelines, tl)
+
+		a, ok := byType[tl.Type]
+		if !ok {
+			a = &acc{stats: TypeStats{Type: tl.Type}}
+			byType[tl.Type] = a
+		}
+		a.stats.Total++
+		a.stats.Retries += tl.Retries
+		switch tl.Status {
+		case models.TaskStatusCompleted:
+			a.stats.Completed++
+		case models.TaskStatusFailed:
+			a.stats.Failed++
+			reason := tl.FailureReason
+			if reason == "" {
+				reason = "unknown"
+			}
+			if a.stats.FailureReasons == nil {
+				a.stats.FailureReasons = make(map[string]int)
+			}
+			a.stats.FailureReasons[reason]++
+		default:
+			a.stats.InFlight++
+		}
+		if d, ok := tl.QueueTime(); ok {
+			a.queue = append(a.queue, d)
+		}
+		if d, ok := tl.ProcessingTime(); ok {
+			a.processing = append(a.processing, d)
+		}
+
+		for _, at := range []time.Time{tl.CreatedAt, tl.FinishedAt} {
+			if at.IsZero() {
+				continue
+			}
+			if a.from.IsZero() || at.Before(a.from) {
+				a.from = at
+			}
+			if at.After(a.to) {
+				a.to = at
+			}
+		}
+	}
+
+	for _, a := range byType {
+		finished := a.stats.Completed + a.stats.Failed
+		if finished > 0 {
+			a.stats.FailureRate = float64(a.stats.Failed) / float64(finished)
+		}
+		if hours := a.to.Sub(a.from).Hours(); hours > 0 {
+			a.stats.Throughput = float64(finished) / hours
+		}
+		a.stats.QueueTime = NewDurationStats(a.queue)
+		a.stats.ProcessingTime = NewDurationStats(a.processing)
+		report.Types = append(report.Types, a.stats)
+
+		if report.From.IsZero() || (!a.from.IsZero() && a.from.Before(report.From)) {
+			report.From = a.from
+		}
+		if a.to.After(report.To) {
+			report.To = a.to
+		}
+	}
+	slices.SortFunc(report.Types, func(a, b TypeStats) int {
+		return cmp.Compare(a.Type, b.Type)
+	})
+
+	return report
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to encode report as JSON: %w", err)
+	}
+	return nil
+}
+
+// WriteCSV writes one row per conversion type, durations being expressed in seconds.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"type", "total", "completed", "failed", "in_flight", "failure_rate", "throughput_per_hour",
+		"queue_p50_s", "queue_p95_s", "processing_p50_s", "processing_p95_s",
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	seconds := func(d time.Duration) string {
+		return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+	}
+	for _, s := range r.Types {
+		row := []string{
+			string(s.Type),
+			strconv.Itoa(s.Total),
+			strconv.Itoa(s.Completed),
+			strconv.Itoa(s.Failed),
+			strconv.Itoa(s.InFlight),
+			strconv.FormatFloat(s.FailureRate, 'f', 4, 64),
+			strconv.FormatFloat(s.Throughput, 'f', 3, 64),
+			seconds(s.QueueTime.P50),
+			seconds(s.QueueTime.P95),
+			seconds(s.ProcessingTime.P50),
+			seconds(s.ProcessingTime.P95),
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV row for %s: %w", s.Type, err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to flush CSV: %w", err)
+	}
+	return nil
+}
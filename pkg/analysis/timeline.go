@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"slices"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// UnknownType is used for tasks whose conversion type cannot be determined.
+const UnknownType models.WorkerType = "unknown"
+
+// Event is a status transition of a task.
+type Event struct {
+	Status  models.TaskStatus `json:"status"`
+	At      time.Time         `json:"at"`
+	Message string            `json:"message,omitempty"`
+}
+
+// Timeline is the reconstructed lifecycle of a single task.
+type Timeline struct {
+	TaskID        string            `json:"taskId"`
+	Type          models.WorkerType `json:"type"`
+	Status        models.TaskStatus `json:"status"`
+	Events        []Event           `json:"events"`
+	CreatedAt     time.Time         `json:"createdAt,omitzero"`
+	StartedAt     time.Time         `json:"startedAt,omitzero"`
+	FinishedAt    time.Time         `json:"finishedAt,omitzero"`
+	FailureReason string            `json:"failureReason,omitempty"`
+	Retries       int               `json:"retries,omitempty"` // Times the task was queued again after a worker took it
+}
+
+// NewTimeline reconstructs the timeline of a task from its timestamps and the status transitions found in its logs.
+func NewTimeline(task models.Task) Timeline {
+	tl := Timeline{TaskID: task.ID, Type: UnknownType, Status: task.Status}
+	if t, ok := task.ConversionType(); ok {
+		tl.Type = t
+	}
+
+	if task.CreatedAt != nil {
+		tl.CreatedAt = *task.CreatedAt
+		tl.Events = append(tl.Events, Event{Status: models.TaskStatusPending, At: tl.CreatedAt})
+	}
+
+	logs := slices.Clone(task.Logs)
+	slices.SortStableFunc(logs, func(a, b models.Log) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	for _, l := range logs {
+		if n := len(tl.Events); n > 0 && tl.Events[n-1].Status == l.TaskStatus {
+			continue
+		}
+		tl.Events = append(tl.Events, Event{Status: l.TaskStatus, At: l.CreatedAt, Message: l.Message})
+	}
+
+	// A task handed back after a failure may be retried and complete: its outcome is the last terminal
+	// event, unless the task was queued again since.
+	taken := false
+	for _, e := range tl.Events {
+		switch {
+		case e.Status == models.TaskStatusPending:
+			if taken {
+				tl.Retries++
+			}
+			tl.FinishedAt, tl.FailureReason = time.Time{}, ""
+		case e.Status == models.TaskStatusProcessing:
+			taken = true
+			if tl.StartedAt.IsZero() {
+				tl.StartedAt = e.At
+			}
+		case e.Status.IsTerminal():
+			taken = true
+			tl.FinishedAt = e.At
+			tl.Status = e.Status
+			tl.FailureReason = ""
+			if e.Status == models.TaskStatusFailed {
+				tl.FailureReason = e.Message
+			}
+		}
+	}
+	if tl.FinishedAt.IsZero() && tl.Status.IsTerminal() {
+		tl.Status = task.Status
+	}
+
+	if tl.FinishedAt.IsZero() && task.Status.IsTerminal() && task.UpdatedAt != nil {
+		tl.FinishedAt = *task.UpdatedAt
+		tl.Events = append(tl.Events, Event{Status: task.Status, At: tl.FinishedAt})
+	}
+	if tl.Status == models.TaskStatusFailed && tl.FailureReason == "" && task.Message != nil {
+		tl.FailureReason = *task.Message
+	}
+
+	return tl
+}
+
+// QueueTime returns the time the task spent waiting before a worker started processing it.
+func (t Timeline) QueueTime() (time.Duration, bool) {
+	if t.CreatedAt.IsZero() || t.StartedAt.IsZero() {
+		return 0, false
+	}
+	return t.StartedAt.Sub(t.CreatedAt), true
+}
+
+// ProcessingTime returns the time between the start of processing and the terminal status,
+// including the attempts that were retried.
+func (t Timeline) ProcessingTime() (time.Duration, bool) {
+	if t.StartedAt.IsZero() || t.FinishedAt.IsZero() {
+		return 0, false
+	}
+	return t.FinishedAt.Sub(t.StartedAt), true
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
@@ -19,6 +20,7 @@ type Client struct {
 	HTTPClient *http.Client
 	BaseURL    string
 	Token      string // JWT token for authentication
+	tokenMu    sync.RWMutex
 
 	Auth            services.AuthService
 	Users           services.UserService
@@ -49,13 +51,42 @@ func NewClient(baseURL, token string) *Client {
 	return c
 }
 
-// Request performs an HTTP request to the API.
+// SetToken replaces the JWT token used for authentication.
+// It is safe to call while other requests are in flight.
+func (c *Client) SetToken(token string) {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	c.Token = token
+}
+
+// GetToken returns the JWT token used for authentication.
+// It is safe to call while the token is being replaced.
+func (c *Client) GetToken() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+	return c.Token
+}
+
+// authorize sets the Authorization header of req when a token is configured.
+func (c *Client) authorize(req *http.Request) {
+	if token := c.GetToken(); token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+}
+
+// Request performs an HTTP request to the API and decodes the data of the response into respBody.
 func (c *Client) Request(ctx context.Context, method, path string, reqBody, respBody interface{}) error {
+	_, err := c.requestEnvelope(ctx, method, path, reqBody, respBody)
+	return err
+}
+
+// requestEnvelope is Request returning the whole response envelope, whose message Request drops.
+func (c *Client) requestEnvelope(ctx context.Context, method, path string, reqBody, respBody interface{}) (*models.APIResponse, error) {
 	var body io.Reader
 	if reqBody != nil {
 		reqBytes, err := json.Marshal(reqBody)
 		if err != nil {
-			return fmt.Errorf("failed to marshal request body for %s %s: %w", method, path, err)
+			return nil, fmt.Errorf("failed to marshal request body for %s %s: %w", method, path, err)
 		}
 		body = bytes.NewBuffer(reqBytes)
 	}
@@ -63,17 +94,15 @@ func (c *Client) Request(ctx context.Context, method, path string, reqBody, resp
 	url := fmt.Sprintf("%s%s", c.BaseURL, path)
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		return fmt.Errorf("failed to create request for %s %s: %w", method, url, err)
+		return nil, fmt.Errorf("failed to create request for %s %s: %w", method, url, err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if c.Token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
-	}
+	c.authorize(req)
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to perform %s request to %s: %w", method, url, err)
+		return nil, fmt.Errorf("failed to perform %s request to %s: %w", method, url, err)
 	}
 	defer resp.Body.Close()
 
@@ -82,9 +111,9 @@ func (c *Client) Request(ctx context.Context, method, path string, reqBody, resp
 		// If we can't decode into APIResponse, try to decode into APIErrorResponse for error handling
 		var apiErrResp models.APIErrorResponse
 		if err := json.NewDecoder(bytes.NewBufferString(resp.Status)).Decode(&apiErrResp); err == nil {
-			return &errors.APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("API error for %s %s: %s", method, url, apiErrResp.Message)}
+			return nil, errors.NewAPIError(resp.StatusCode, fmt.Sprintf("API error for %s %s: %s", method, url, apiErrResp.Message))
 		}
-		return fmt.Errorf("failed to decode API response for %s %s: %w", method, url, err)
+		return nil, fmt.Errorf("failed to decode API response for %s %s: %w", method, url, err)
 	}
 
 	if !apiResponse.Success {
@@ -102,20 +131,31 @@ func (c *Client) Request(ctx context.Context, method, path string, reqBody, resp
 		} else {
 			errMsg = fmt.Sprintf("API error with status %d for %s %s", resp.StatusCode, method, url)
 		}
-		return &errors.APIError{StatusCode: resp.StatusCode, Message: errMsg}
+		return nil, errors.NewAPIError(resp.StatusCode, errMsg)
 	}
 
 	if respBody != nil && apiResponse.Data != nil {
 		dataBytes, err := json.Marshal(apiResponse.Data)
 		if err != nil {
-			return fmt.Errorf("failed to marshal API response data for %s %s: %w", method, url, err)
+			return nil, fmt.Errorf("failed to marshal API response data for %s %s: %w", method, url, err)
 		}
 		if err := json.Unmarshal(dataBytes, respBody); err != nil {
-			return fmt.Errorf("failed to unmarshal API response data for %s %s: %w", method, url, err)
+			return nil, fmt.Errorf("failed to unmarshal API response data for %s %s: %w", method, url, err)
 		}
 	}
 
-	return nil
+	return &apiResponse, nil
+}
+
+// responseError returns the error message carried by an unsuccessful API response.
+func responseError(apiResponse models.APIResponse) string {
+	if apiResponse.Message != "" {
+		return apiResponse.Message
+	}
+	if apiResponse.Error != nil {
+		return fmt.Sprint(*apiResponse.Error)
+	}
+	return "unknown error"
 }
 
 // Get performs a GET request.
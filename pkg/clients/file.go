@@ -53,9 +53,7 @@ func (c *FileClient) UploadFile(ctx context.Context, name string, file []byte) (
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
-	if c.client.Token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.client.Token))
-	}
+	c.client.authorize(req)
 
 	resp, err := c.client.HTTPClient.Do(req)
 	if err != nil {
@@ -69,7 +67,7 @@ func (c *FileClient) UploadFile(ctx context.Context, name string, file []byte) (
 	}
 
 	if !apiResponse.Success {
-		return nil, &errors.APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("API error for upload to %s: %s", url, *apiResponse.Error)}
+		return nil, errors.NewAPIError(resp.StatusCode, fmt.Sprintf("API error for upload to %s: %s", url, responseError(apiResponse)))
 	}
 
 	fileResp := &models.File{}
@@ -104,9 +102,7 @@ func (c *FileClient) DownloadFile(ctx context.Context, cuid string) ([]byte, err
 		return nil, fmt.Errorf("failed to create download request to %s: %w", url, err)
 	}
 
-	if c.client.Token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.client.Token))
-	}
+	c.client.authorize(req)
 
 	resp, err := c.client.HTTPClient.Do(req)
 	if err != nil {
@@ -119,7 +115,7 @@ func (c *FileClient) DownloadFile(ctx context.Context, cuid string) ([]byte, err
 		if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
 			return nil, fmt.Errorf("API error with status %d for download from %s: %s", resp.StatusCode, url, resp.Status)
 		}
-		return nil, &errors.APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("API error for download from %s: %s", url, *apiResponse.Error)}
+		return nil, errors.NewAPIError(resp.StatusCode, fmt.Sprintf("API error for download from %s: %s", url, responseError(apiResponse)))
 	}
 
 	return io.ReadAll(resp.Body)
@@ -3,19 +3,41 @@ package clients
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"io"
+	"iter"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
 )
 
-// TaskClient implements services.TaskService.
+const (
+	// defaultFollowInterval is the polling interval used by FollowLogs when none is given.
+	defaultFollowInterval = 2 * time.Second
+	// longPollMargin is kept between a long-poll wait and the HTTP client timeout.
+	longPollMargin = 5 * time.Second
+)
+
+// TaskClient implements services.TaskService, services.TaskWorkerService and services.TaskLogService.
 type TaskClient struct {
 	client *Client
+	// plainPolls is set once the API has rejected the query parameters of a poll.
+	plainPolls atomic.Bool
 }
 
 // NewTaskClient creates a new TaskClient.
@@ -49,66 +71,287 @@ func (c *TaskClient) DeleteTask(ctx context.Context, cuid string) error {
 }
 
 // GetPendingTask retrieves a pending task for a worker.
+// It returns errors.ErrNoPendingTask when the queue is empty.
 func (c *TaskClient) GetPendingTask(ctx context.Context) (*models.Task, error) {
+	return c.GetPendingTaskWithOptions(ctx, models.PendingTaskOptions{})
+}
+
+// GetPendingTaskWithOptions retrieves a pending task for a worker.
+// When opts.Wait is set, the API holds the request until a task is available or the wait expires,
+// and opts.Types restricts the claim to the given task types.
+// The wait and types query parameters are extensions missing from the documented API: once the
+// API rejects them with errors.ErrBadRequest, the client polls without them, as GetPendingTask.
+// It returns errors.ErrNoPendingTask when the queue is empty.
+func (c *TaskClient) GetPendingTaskWithOptions(ctx context.Context, opts models.PendingTaskOptions) (*models.Task, error) {
+	if c.plainPolls.Load() {
+		opts = models.PendingTaskOptions{}
+	}
+	query := url.Values{}
+	if wait := c.longPollWait(opts.Wait); wait > 0 {
+		query.Set("wait", strconv.Itoa(int(wait.Seconds())))
+	}
+	if len(opts.Types) > 0 {
+		types := make([]string, len(opts.Types))
+		for i, t := range opts.Types {
+			types[i] = string(t)
+		}
+		query.Set("types", strings.Join(types, ","))
+	}
+	path := "/tasks/pending"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
 	task := &models.Task{}
-	err := c.client.Get(ctx, "/tasks/pending", task)
+	err := c.client.Get(ctx, path, task)
+	if stderrors.Is(err, errors.ErrBadRequest) && len(query) > 0 {
+		c.plainPolls.Store(true)
+		return c.GetPendingTaskWithOptions(ctx, models.PendingTaskOptions{})
+	}
+	if stderrors.Is(err, errors.ErrNotFound) {
+		return nil, errors.ErrNoPendingTask
+	}
 	if err != nil {
 		return nil, err
 	}
 	return task, nil
 }
 
+// longPollWait clamps wait so that the API answers before the HTTP client times out.
+func (c *TaskClient) longPollWait(wait time.Duration) time.Duration {
+	if timeout := c.client.HTTPClient.Timeout; timeout > 0 && wait > timeout-longPollMargin {
+		wait = timeout - longPollMargin
+	}
+	return wait.Truncate(time.Second)
+}
+
 // UpdateTaskStatus updates the status of a task.
+// It returns an error matching errors.ErrLeaseLost when the task is assigned to another worker.
 func (c *TaskClient) UpdateTaskStatus(ctx context.Context, cuid string, req models.UpdateTaskStatusRequest) error {
-	return c.client.Patch(ctx, fmt.Sprintf("/tasks/%s", cuid), req, nil)
+	return leaseError(c.client.Patch(ctx, fmt.Sprintf("/tasks/%s", cuid), req, nil))
 }
 
-// UploadTaskResult uploads the result of a task.
-func (c *TaskClient) UploadTaskResult(ctx context.Context, cuid string, filename string, file []byte) error {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	part, err := writer.CreateFormFile("file", filename)
+// RenewTaskLease extends the assignment of a task to the authenticated worker.
+// POST /tasks/:id/lease is an extension missing from the documented API, which answers it as not found.
+// It returns an error matching errors.ErrLeaseLost when the task is assigned to another worker.
+func (c *TaskClient) RenewTaskLease(ctx context.Context, cuid string) (*models.TaskLease, error) {
+	lease := &models.TaskLease{}
+	err := c.client.Post(ctx, fmt.Sprintf("/tasks/%s/lease", cuid), nil, lease)
 	if err != nil {
-		return fmt.Errorf("failed to create form file: %w", err)
+		return nil, leaseError(err)
 	}
-	if _, err := part.Write(file); err != nil {
-		return fmt.Errorf("failed to write file content: %w", err)
+	return lease, nil
+}
+
+// leaseError marks conflicts on a task as a lost lease.
+func leaseError(err error) error {
+	if stderrors.Is(err, errors.ErrConflict) {
+		return fmt.Errorf("%w: %w", errors.ErrLeaseLost, err)
 	}
+	return err
+}
 
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close multipart writer: %w", err)
+// UploadTaskResult uploads the in-memory result of a task.
+func (c *TaskClient) UploadTaskResult(ctx context.Context, cuid string, filename string, file []byte) error {
+	_, err := c.UploadTaskResults(ctx, cuid, models.UploadTaskResultRequest{
+		Outputs: []models.ResultOutput{{Filename: filename, Reader: bytes.NewReader(file)}},
+	})
+	return err
+}
+
+// UploadTaskResults streams the outputs of a task as its result, without buffering them, and
+// returns the created result file. The outputs are sent as "file" parts in order, followed by the
+// metadata as a JSON "metadata" field.
+func (c *TaskClient) UploadTaskResults(ctx context.Context, cuid string, req models.UploadTaskResultRequest) (*models.File, error) {
+	if len(req.Outputs) == 0 {
+		return nil, stderrors.New("no result output to upload")
 	}
 
+	body, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		pw.CloseWithError(writeResultParts(writer, req))
+	}()
+	// The outputs must not be read anymore once the upload returns.
+	defer func() {
+		body.Close()
+		<-written
+	}()
+
 	url := fmt.Sprintf("%s/tasks/%s/result", c.client.BaseURL, cuid)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	if c.client.Token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.client.Token))
-	}
+	httpReq.Header.Set("Content-Type", writer.FormDataContentType())
+	c.client.authorize(httpReq)
 
-	resp, err := c.client.HTTPClient.Do(req)
+	resp, err := c.client.HTTPClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("failed to perform request: %w", err)
+		return nil, fmt.Errorf("failed to perform request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var apiResponse models.APIResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
-		return fmt.Errorf("failed to decode API response: %w", err)
+		return nil, fmt.Errorf("failed to decode API response: %w", err)
 	}
 
 	if !apiResponse.Success {
-		return &errors.APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("API error: %s", *apiResponse.Error)}
+		return nil, leaseError(errors.NewAPIError(resp.StatusCode, fmt.Sprintf("API error: %s", responseError(apiResponse))))
+	}
+
+	result := &models.File{}
+	if apiResponse.Data != nil {
+		dataBytes, err := json.Marshal(apiResponse.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal API response data: %w", err)
+		}
+		if err := json.Unmarshal(dataBytes, result); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal result file: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// writeResultParts writes the multipart body of a result upload. The checksum of the primary
+// output is computed while it is written, and sent with the metadata when it has none.
+func writeResultParts(writer *multipart.Writer, req models.UploadTaskResultRequest) error {
+	var checksum string
+	for i, output := range req.Outputs {
+		sum, err := writeResultPart(writer, output)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			checksum = sum
+		}
+	}
+
+	if req.Metadata != nil {
+		metadata := *req.Metadata
+		if metadata.Checksum == "" {
+			metadata.Checksum = checksum
+		}
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result metadata: %w", err)
+		}
+		if err := writer.WriteField("metadata", string(data)); err != nil {
+			return fmt.Errorf("failed to write metadata field: %w", err)
+		}
 	}
 
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close multipart writer: %w", err)
+	}
 	return nil
 }
 
+// writeResultPart streams an output into a "file" part and returns its hex SHA-256.
+func writeResultPart(writer *multipart.Writer, output models.ResultOutput) (string, error) {
+	filename := output.Filename
+	r := output.Reader
+	if r == nil {
+		if output.Path == "" {
+			return "", fmt.Errorf("result output %q has neither a reader nor a path", filename)
+		}
+		f, err := os.Open(output.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open result output: %w", err)
+		}
+		defer f.Close()
+		r = f
+		if filename == "" {
+			filename = filepath.Base(output.Path)
+		}
+	}
+
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to create form file: %w", err)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(part, hash), r); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// GetTaskLogs retrieves the logs of a task, optionally restricted to entries created after since.
+// A zero since returns every log of the task. The API has no logs endpoint: the logs are read from
+// the tasks of the authenticated user, so the task must belong to them.
+func (c *TaskClient) GetTaskLogs(ctx context.Context, cuid string, since time.Time) ([]models.Log, error) {
+	_, logs, err := c.taskLogs(ctx, cuid, since)
+	return logs, err
+}
+
+// taskLogs returns a task of the authenticated user and its logs created after since, in order.
+func (c *TaskClient) taskLogs(ctx context.Context, cuid string, since time.Time) (*models.Task, []models.Log, error) {
+	tasks, err := c.GetUserTasks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	i := slices.IndexFunc(tasks, func(t models.Task) bool { return t.ID == cuid })
+	if i < 0 {
+		return nil, nil, fmt.Errorf("task %s: %w", cuid, errors.ErrNotFound)
+	}
+	logs := []models.Log{}
+	for _, l := range tasks[i].Logs {
+		if since.IsZero() || l.CreatedAt.After(since) {
+			logs = append(logs, l)
+		}
+	}
+	slices.SortStableFunc(logs, func(a, b models.Log) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return &tasks[i], logs, nil
+}
+
+// FollowLogs polls the logs of a task every interval and yields each new entry in order.
+// Iteration stops once the task has reached a terminal status and its logs have been yielded,
+// or after yielding an error.
+func (c *TaskClient) FollowLogs(ctx context.Context, cuid string, interval time.Duration) iter.Seq2[models.Log, error] {
+	if interval <= 0 {
+		interval = defaultFollowInterval
+	}
+	return func(yield func(models.Log, error) bool) {
+		// Every log is fetched each time: logs sharing a timestamp may be added between two polls.
+		seen := make(map[string]struct{})
+		for {
+			task, logs, err := c.taskLogs(ctx, cuid, time.Time{})
+			if err != nil {
+				yield(models.Log{}, err)
+				return
+			}
+			for _, l := range logs {
+				if _, ok := seen[l.ID]; ok {
+					continue
+				}
+				seen[l.ID] = struct{}{}
+				if !yield(l, nil) {
+					return
+				}
+			}
+			if task.Status.IsTerminal() {
+				return
+			}
+
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				yield(models.Log{}, ctx.Err())
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
 // Build creates a new TaskBuilder.
 func (c *TaskClient) Build(fileID string) services.TaskBuilder {
 	return NewTaskBuilder(c, fileID)
@@ -3,12 +3,13 @@ package clients
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
 )
 
-// WorkerClient implements services.WorkerService.
+// WorkerClient implements services.WorkerService and services.HeartbeatService.
 type WorkerClient struct {
 	client *Client
 }
@@ -58,10 +59,11 @@ func (c *WorkerClient) DeleteWorker(ctx context.Context, cuid string) error {
 func (c *WorkerClient) RegisterWorker(ctx context.Context, token string) (*models.AuthWorkerResponse, error) {
 	req := models.RegisterWorkerRequest{Token: token}
 	resp := &models.AuthWorkerResponse{}
-	err := c.client.Post(ctx, "/worker/register", req, resp)
+	envelope, err := c.client.requestEnvelope(ctx, http.MethodPost, "/worker/register", req, &resp.Data)
 	if err != nil {
 		return nil, err
 	}
+	resp.Success, resp.Message = envelope.Success, envelope.Message
 	return resp, nil
 }
 
@@ -69,9 +71,16 @@ func (c *WorkerClient) RegisterWorker(ctx context.Context, token string) (*model
 func (c *WorkerClient) RefreshAuth(ctx context.Context, refreshToken string) (*models.AuthWorkerResponse, error) {
 	req := models.RefreshTokenRequest{RefreshToken: refreshToken}
 	resp := &models.AuthWorkerResponse{}
-	err := c.client.Post(ctx, "/worker/refresh-auth", req, resp)
+	envelope, err := c.client.requestEnvelope(ctx, http.MethodPost, "/worker/refresh-auth", req, &resp.Data)
 	if err != nil {
 		return nil, err
 	}
+	resp.Success, resp.Message = envelope.Success, envelope.Message
 	return resp, nil
 }
+
+// Heartbeat reports the status of the authenticated worker.
+// POST /worker/heartbeat is a non-standard extension, not part of the documented API.
+func (c *WorkerClient) Heartbeat(ctx context.Context, req models.HeartbeatRequest) error {
+	return c.client.Post(ctx, "/worker/heartbeat", req, nil)
+}
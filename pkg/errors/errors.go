@@ -3,6 +3,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"net/http"
 )
 
 // APIError represents a detailed error returned by the QAlpuch API.
@@ -20,12 +21,43 @@ func (e *APIError) Unwrap() error {
 	return e.Err
 }
 
+// NewAPIError creates an APIError wrapping the sentinel error matching statusCode.
+func NewAPIError(statusCode int, message string) *APIError {
+	return &APIError{StatusCode: statusCode, Message: message, Err: ForStatus(statusCode)}
+}
+
+// ForStatus returns the sentinel error matching an HTTP status code.
+func ForStatus(statusCode int) error {
+	switch {
+	case statusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case statusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case statusCode == http.StatusForbidden:
+		return ErrForbidden
+	case statusCode == http.StatusNotFound:
+		return ErrNotFound
+	case statusCode == http.StatusConflict:
+		return ErrConflict
+	case statusCode >= http.StatusInternalServerError:
+		return ErrInternalServer
+	default:
+		return ErrUnknown
+	}
+}
+
 // Sentinel errors for common API issues.
 var (
 	ErrBadRequest     = errors.New("bad request")
 	ErrUnauthorized   = errors.New("unauthorized")
 	ErrForbidden      = errors.New("forbidden")
 	ErrNotFound       = errors.New("not found")
+	ErrConflict       = errors.New("conflict")
 	ErrInternalServer = errors.New("internal server error")
 	ErrUnknown        = errors.New("an unknown API error occurred")
+
+	// ErrNoPendingTask is returned when a worker polls an empty task queue.
+	ErrNoPendingTask = errors.New("no pending task")
+	// ErrLeaseLost is returned when a task the worker was processing has been assigned to another worker.
+	ErrLeaseLost = errors.New("task lease lost")
 )
@@ -1,5 +1,11 @@
 package models
 
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
 // AudioConversionConfig holds the specific parameters for audio conversion.
 type AudioConversionConfig struct {
 	Type    string `json:"type" validate:"required,eq=audio"`
@@ -87,3 +93,54 @@ func (c *ImageConversionConfig) WithHeight(height int) *ImageConversionConfig {
 	c.Height = height
 	return c
 }
+
+// resolutionPattern matches the WIDTHxHEIGHT resolutions of video conversions.
+var resolutionPattern = regexp.MustCompile(`^[1-9][0-9]*x[1-9][0-9]*$`)
+
+// Validate checks the configuration against the constraints of its validate tags.
+func (c *AudioConversionConfig) Validate() error {
+	if c.Type != string(WorkerTypeAudio) {
+		return fmt.Errorf("invalid conversion type %q, expected %q", c.Type, WorkerTypeAudio)
+	}
+	if c.Codec != "" && !slices.Contains([]string{"mp3", "aac", "opus"}, c.Codec) {
+		return fmt.Errorf("unsupported audio codec %q", c.Codec)
+	}
+	if c.Bitrate < 0 {
+		return fmt.Errorf("invalid bitrate %d", c.Bitrate)
+	}
+	return nil
+}
+
+// Validate checks the configuration against the constraints of its validate tags.
+func (c *VideoConversionConfig) Validate() error {
+	if c.Type != string(WorkerTypeVideo) {
+		return fmt.Errorf("invalid conversion type %q, expected %q", c.Type, WorkerTypeVideo)
+	}
+	if c.Codec != "" && !slices.Contains([]string{"h264", "vp9", "av1"}, c.Codec) {
+		return fmt.Errorf("unsupported video codec %q", c.Codec)
+	}
+	if c.Bitrate < 0 {
+		return fmt.Errorf("invalid bitrate %d", c.Bitrate)
+	}
+	if c.Resolution != "" && !resolutionPattern.MatchString(c.Resolution) {
+		return fmt.Errorf("invalid resolution %q, expected WIDTHxHEIGHT", c.Resolution)
+	}
+	return nil
+}
+
+// Validate checks the configuration against the constraints of its validate tags.
+func (c *ImageConversionConfig) Validate() error {
+	if c.Type != string(WorkerTypeImage) {
+		return fmt.Errorf("invalid conversion type %q, expected %q", c.Type, WorkerTypeImage)
+	}
+	if c.Format != "" && !slices.Contains([]string{"jpeg", "png", "webp"}, c.Format) {
+		return fmt.Errorf("unsupported image format %q", c.Format)
+	}
+	if c.Quality != 0 && (c.Quality < 1 || c.Quality > 100) {
+		return fmt.Errorf("invalid quality %d, expected 1-100", c.Quality)
+	}
+	if c.Width < 0 || c.Height < 0 {
+		return fmt.Errorf("invalid dimensions %dx%d", c.Width, c.Height)
+	}
+	return nil
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"io"
+	"time"
+)
+
 type CreateTaskRequest struct {
 	FileID           string       `json:"fileId"`
 	Config           *interface{} `json:"config,omitempty"`
@@ -19,6 +24,16 @@ type RegisterWorkerRequest struct {
 	Token string `json:"token"`
 }
 
+// HeartbeatRequest reports the state of a running worker.
+type HeartbeatRequest struct {
+	Status  WorkerStatus `json:"status"`
+	TaskIDs []string     `json:"taskIds"`
+	Load    float64      `json:"load"` // Share of busy slots, from 0 to 1
+	Version string       `json:"version,omitempty"`
+
+	Capabilities []WorkerType `json:"capabilities,omitempty"`
+}
+
 type CreateUserRequest struct {
 	Name  string `json:"name"`
 	Email string `json:"email"`
@@ -34,9 +49,42 @@ type UpdateUserRequest struct {
 type UpdateTaskStatusRequest struct {
 	Status        TaskStatus `json:"status"`
 	StatusMessage string     `json:"message"`
+	Progress      *float64   `json:"progress,omitempty"` // Percentage between 0 and 100
 }
 
 type UpdateTaskRequest struct {
 	Status       *TaskStatus `json:"status,omitempty"`
 	ResultFileID *string     `json:"resultFileId,omitempty"`
 }
+
+// PendingTaskOptions tunes how a worker polls the task queue.
+// Both options are extensions of the documented API, only honoured by servers implementing them.
+type PendingTaskOptions struct {
+	Wait  time.Duration // Long-poll duration, zero to return immediately
+	Types []WorkerType  // Only claim tasks of these types, in order of preference; empty for any
+}
+
+// UploadTaskResultRequest describes the outputs of a task uploaded as its result.
+// The first output is the primary result; the others, such as thumbnails or segment
+// archives, are attached to it.
+type UploadTaskResultRequest struct {
+	Outputs  []ResultOutput
+	Metadata *ResultMetadata // Optional
+}
+
+// ResultOutput is a file uploaded as part of a task result. It is streamed from Reader,
+// or from the file at Path when Reader is nil.
+type ResultOutput struct {
+	Filename string
+	Path     string
+	Reader   io.Reader
+}
+
+// ResultMetadata describes the primary output of a task result.
+type ResultMetadata struct {
+	Duration float64           `json:"duration,omitempty"` // In seconds, for audio and video
+	Width    int               `json:"width,omitempty"`
+	Height   int               `json:"height,omitempty"`
+	Checksum string            `json:"checksum,omitempty"` // Hex SHA-256 of the primary output, computed during the upload if empty
+	Extra    map[string]string `json:"extra,omitempty"`
+}
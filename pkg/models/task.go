@@ -1,13 +1,25 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 type TaskStatus string
 
 const (
+	TaskStatusPending    TaskStatus = "pending"
 	TaskStatusProcessing TaskStatus = "processing"
+	TaskStatusCompleted  TaskStatus = "completed"
+	TaskStatusFailed     TaskStatus = "failed"
 )
 
+// IsTerminal reports whether no further status change is expected for the task.
+func (s TaskStatus) IsTerminal() bool {
+	return s == TaskStatusCompleted || s == TaskStatusFailed
+}
+
 type Task struct {
 	ID           string      `json:"id"`
 	Config       interface{} `json:"config"`
@@ -22,6 +34,12 @@ type Task struct {
 	UpdatedAt    *time.Time  `json:"updatedAt,omitempty"`
 }
 
+// TaskLease is the assignment of a task to the worker processing it.
+type TaskLease struct {
+	TaskID    string    `json:"taskId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type Log struct {
 	ID         string     `json:"id"`
 	TaskID     string     `json:"taskId"`
@@ -30,3 +48,67 @@ type Log struct {
 	CreatedAt  time.Time  `json:"created_at"`
 	UpdatedAt  time.Time  `json:"updated_at"`
 }
+
+// DecodeConfig decodes the task configuration into v.
+// The API may return the configuration either as a JSON object or as a JSON-encoded string.
+func (t *Task) DecodeConfig(v interface{}) error {
+	var raw []byte
+	switch config := t.Config.(type) {
+	case nil:
+		return fmt.Errorf("task %s has no configuration", t.ID)
+	case string:
+		raw = []byte(config)
+	default:
+		b, err := json.Marshal(config)
+		if err != nil {
+			return fmt.Errorf("failed to marshal configuration of task %s: %w", t.ID, err)
+		}
+		raw = b
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("failed to decode configuration of task %s: %w", t.ID, err)
+	}
+	return nil
+}
+
+// ConversionType returns the kind of conversion requested by the task.
+// It uses Type when set and falls back to the "type" field of the configuration.
+func (t *Task) ConversionType() (WorkerType, bool) {
+	if t.Type != nil && *t.Type != "" {
+		return *t.Type, true
+	}
+	var config struct {
+		Type WorkerType `json:"type"`
+	}
+	if err := t.DecodeConfig(&config); err != nil || config.Type == "" {
+		return "", false
+	}
+	return config.Type, true
+}
+
+// ValidateConfig decodes the configuration of the task according to its conversion type
+// and checks it. It returns the conversion type.
+func (t *Task) ValidateConfig() (WorkerType, error) {
+	workerType, ok := t.ConversionType()
+	if !ok {
+		return "", fmt.Errorf("task %s has no conversion type", t.ID)
+	}
+	var config interface{ Validate() error }
+	switch workerType {
+	case WorkerTypeAudio:
+		config = &AudioConversionConfig{}
+	case WorkerTypeVideo:
+		config = &VideoConversionConfig{}
+	case WorkerTypeImage:
+		config = &ImageConversionConfig{}
+	default:
+		return workerType, fmt.Errorf("unknown conversion type %q", workerType)
+	}
+	if err := t.DecodeConfig(config); err != nil {
+		return workerType, err
+	}
+	if err := config.Validate(); err != nil {
+		return workerType, fmt.Errorf("invalid configuration of task %s: %w", t.ID, err)
+	}
+	return workerType, nil
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"iter"
+	"time"
 
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
 )
@@ -43,6 +45,22 @@ type TaskService interface {
 	Build(fileID string) TaskBuilder
 }
 
+// TaskWorkerService defines the task operations of workers which TaskService lacks.
+// It is kept apart so that existing implementations of TaskService remain valid;
+// the TaskService of clients.NewTaskClient implements it.
+type TaskWorkerService interface {
+	GetPendingTaskWithOptions(ctx context.Context, opts models.PendingTaskOptions) (*models.Task, error)
+	RenewTaskLease(ctx context.Context, cuid string) (*models.TaskLease, error)
+	UploadTaskResults(ctx context.Context, cuid string, req models.UploadTaskResultRequest) (*models.File, error)
+}
+
+// TaskLogService defines the operations on the logs of a task.
+// The TaskService of clients.NewTaskClient implements it.
+type TaskLogService interface {
+	GetTaskLogs(ctx context.Context, cuid string, since time.Time) ([]models.Log, error)
+	FollowLogs(ctx context.Context, cuid string, interval time.Duration) iter.Seq2[models.Log, error]
+}
+
 // TaskBuilder defines the fluent interface for building a task.
 type TaskBuilder interface {
 	WithVideoConfig(config models.VideoConversionConfig) TaskBuilder
@@ -60,6 +78,12 @@ type WorkerService interface {
 	RefreshAuth(ctx context.Context, refreshToken string) (*models.AuthWorkerResponse, error)
 }
 
+// HeartbeatService defines the heartbeat of workers, a non-standard extension of the API.
+// The WorkerService of clients.NewWorkerClient implements it.
+type HeartbeatService interface {
+	Heartbeat(ctx context.Context, req models.HeartbeatRequest) error
+}
+
 // PredefinedTaskService defines the interface for predefined task operations.
 type PredefinedTaskService interface {
 	CreatePredefinedTask(ctx context.Context, req models.CreatePredefinedTaskRequest) (*models.PredefinedTask, error)
@@ -0,0 +1,61 @@
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/analysis"
+)
+
+// Report holds the measurements of a simulation.
+type Report struct {
+	Workers   int           `json:"workers"`
+	Tasks     int           `json:"tasks"`
+	Completed int           `json:"completed"`
+	Failed    int           `json:"failed"` // Failed by the synthetic handler
+	Duration  time.Duration `json:"-"`
+
+	Throughput   float64                `json:"throughputPerSecond"` // Finished tasks per second
+	ClaimLatency analysis.DurationStats `json:"claimLatency"`        // Duration of the successful claim requests
+	QueueTime    analysis.DurationStats `json:"queueTime"`           // From the creation of a task to its first claim
+
+	Requests        int            `json:"requests"`
+	Errors          int            `json:"errors"`
+	ErrorRate       float64        `json:"errorRate"`
+	ErrorsByRequest map[string]int `json:"errorsByRequest,omitempty"`
+
+	// DuplicateClaims counts the tasks handed to a worker while another one was still processing them.
+	DuplicateClaims int `json:"duplicateClaims"`
+	LeasesLost      int `json:"leasesLost"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	type report Report
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		*report
+		Duration float64 `json:"durationSeconds"`
+	}{(*report)(r), r.Duration.Seconds()})
+}
+
+// String summarizes the report in a few lines.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d workers, %d tasks in %s: %d completed, %d failed, %.1f tasks/s\n",
+		r.Workers, r.Tasks, r.Duration.Round(time.Millisecond), r.Completed, r.Failed, r.Throughput)
+	fmt.Fprintf(&b, "claim latency: p50 %s, p95 %s; queue time: p50 %s, p95 %s\n",
+		r.ClaimLatency.P50, r.ClaimLatency.P95, r.QueueTime.P50, r.QueueTime.P95)
+	fmt.Fprintf(&b, "requests: %d, errors: %d (%.2f%%)", r.Requests, r.Errors, 100*r.ErrorRate)
+	for _, operation := range slices.Sorted(maps.Keys(r.ErrorsByRequest)) {
+		fmt.Fprintf(&b, ", %s %d", operation, r.ErrorsByRequest[operation])
+	}
+	fmt.Fprintf(&b, "\nduplicate claims: %d, leases lost: %d", r.DuplicateClaims, r.LeasesLost)
+	return b.String()
+}
@@ -0,0 +1,449 @@
+package simulation
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+const (
+	defaultLeaseDuration = 30 * time.Second
+	// maxLongPoll bounds the long-poll waits honoured by the server.
+	maxLongPoll = 30 * time.Second
+)
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithLeaseDuration sets how long a claimed task stays assigned to its worker without a renewal.
+// Expired tasks are handed to the next worker polling the queue.
+func WithLeaseDuration(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.leaseDuration = d
+	}
+}
+
+// WithLatency delays every response of the server by d.
+func WithLatency(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.latency = d
+	}
+}
+
+// WithErrorRate makes the server fail the given share of requests, from 0 to 1, with a 503 status.
+func WithErrorRate(rate float64) ServerOption {
+	return func(s *Server) {
+		s.errorRate = rate
+	}
+}
+
+// simTask is a task stored by the Server.
+type simTask struct {
+	task   models.Task
+	holder string // Authorization header of the worker holding the lease
+	expiry time.Time
+}
+
+func (t *simTask) setStatus(status models.TaskStatus) {
+	now := time.Now().UTC()
+	t.task.Status = status
+	t.task.UpdatedAt = &now
+}
+
+// Server is an in-memory implementation of the task queue and worker endpoints of the API.
+// Workers are identified by their token; a task is assigned to one worker at a time, until
+// it reports a terminal status, hands the task back or lets its lease expire.
+type Server struct {
+	leaseDuration time.Duration
+	latency       time.Duration
+	errorRate     float64
+
+	server *httptest.Server
+
+	mu      sync.Mutex
+	tasks   map[string]*simTask
+	leased  map[string]*simTask // Tasks assigned to a worker
+	queue   []string            // IDs of the pending tasks, oldest first
+	files   map[string][]byte
+	used    map[string]bool // Registration tokens already exchanged
+	workers int
+	ids     int
+	changed chan struct{} // Closed when a task is queued
+}
+
+// NewServer starts a Server listening on a local address.
+func NewServer(opts ...ServerOption) *Server {
+	s := &Server{
+		leaseDuration: defaultLeaseDuration,
+		tasks:         make(map[string]*simTask),
+		leased:        make(map[string]*simTask),
+		files:         make(map[string][]byte),
+		used:          make(map[string]bool),
+		changed:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/worker", s.createWorker)
+	mux.HandleFunc("DELETE /v1/worker/{id}", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, nil)
+	})
+	mux.HandleFunc("POST /v1/worker/register", s.register)
+	mux.HandleFunc("POST /v1/worker/refresh-auth", s.refreshAuth)
+	mux.HandleFunc("POST /v1/worker/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, http.StatusOK, nil)
+	})
+	mux.HandleFunc("POST /v1/files/upload", s.upload)
+	mux.HandleFunc("GET /v1/files/{id}", s.fileMetadata)
+	mux.HandleFunc("GET /v1/files/{id}/download", s.download)
+	mux.HandleFunc("POST /v1/tasks", s.createTask)
+	mux.HandleFunc("GET /v1/tasks/pending", s.claim)
+	mux.HandleFunc("PATCH /v1/tasks/{id}", s.updateStatus)
+	mux.HandleFunc("POST /v1/tasks/{id}/lease", s.renewLease)
+	mux.HandleFunc("POST /v1/tasks/{id}/result", s.uploadResult)
+	s.server = httptest.NewServer(s.inject(mux))
+	return s
+}
+
+// URL returns the base URL of the API, to be given to clients.NewClient.
+func (s *Server) URL() string {
+	return s.server.URL + "/v1"
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Counts returns the number of tasks of each status.
+func (s *Server) Counts() map[models.TaskStatus]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLeases()
+	counts := make(map[models.TaskStatus]int)
+	for _, t := range s.tasks {
+		counts[t.task.Status]++
+	}
+	return counts
+}
+
+// inject adds the configured latency and failures to every request.
+func (s *Server) inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.latency > 0 {
+			select {
+			case <-time.After(s.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if s.errorRate > 0 && rand.Float64() < s.errorRate {
+			fail(w, http.StatusServiceUnavailable, "Simulated failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) createWorker(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWorkerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	s.mu.Lock()
+	id := s.nextID("worker")
+	s.mu.Unlock()
+	token := "sim_registration_token_" + id
+	capabilities := make([]models.WorkerType, len(req.Capabilities))
+	for i, c := range req.Capabilities {
+		capabilities[i] = models.WorkerType(c)
+	}
+	respond(w, http.StatusCreated, models.Worker{ID: id, Name: req.Name, Token: &token, Capabilities: capabilities})
+}
+
+// register exchanges a registration token for a worker token. Like the API, each registration
+// token can only be used once; any unused token is accepted.
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var req models.RegisterWorkerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		fail(w, http.StatusBadRequest, "Missing registration token")
+		return
+	}
+	s.mu.Lock()
+	if s.used[req.Token] {
+		s.mu.Unlock()
+		fail(w, http.StatusUnauthorized, "Registration token already used")
+		return
+	}
+	s.used[req.Token] = true
+	s.mu.Unlock()
+	s.issueToken(w)
+}
+
+func (s *Server) refreshAuth(w http.ResponseWriter, r *http.Request) {
+	s.issueToken(w)
+}
+
+// issueToken responds with the tokens of a new worker.
+func (s *Server) issueToken(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.workers++
+	n := s.workers
+	s.mu.Unlock()
+	respond(w, http.StatusOK, models.AuthWorkerResponseData{
+		Token:        fmt.Sprintf("sim_worker_token_%d", n),
+		RefreshToken: fmt.Sprintf("sim_refresh_token_%d", n),
+	})
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		fail(w, http.StatusBadRequest, "Missing file")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	s.mu.Lock()
+	id := s.nextID("file")
+	s.files[id] = data
+	s.mu.Unlock()
+	respond(w, http.StatusOK, fileMetadata(id, header.Filename, data))
+}
+
+func (s *Server) fileMetadata(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.files[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		fail(w, http.StatusNotFound, "File not found")
+		return
+	}
+	respond(w, http.StatusOK, fileMetadata(r.PathValue("id"), "source.bin", data))
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.files[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		fail(w, http.StatusNotFound, "File not found")
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateTaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[req.FileID]; !ok {
+		fail(w, http.StatusNotFound, "File not found")
+		return
+	}
+	fileID := req.FileID
+	now := time.Now().UTC()
+	task := models.Task{ID: s.nextID("task"), Status: models.TaskStatusPending, SourceFileID: &fileID, CreatedAt: &now, UpdatedAt: &now}
+	if req.Config != nil {
+		task.Config = *req.Config
+	}
+	s.tasks[task.ID] = &simTask{task: task}
+	s.enqueue(task.ID)
+	respond(w, http.StatusCreated, task)
+}
+
+// claim assigns the oldest pending task to the worker, waiting for one up to the requested duration.
+func (s *Server) claim(w http.ResponseWriter, r *http.Request) {
+	wait, _ := strconv.Atoi(r.URL.Query().Get("wait"))
+	deadline := time.Now().Add(min(time.Duration(wait)*time.Second, maxLongPoll))
+	var types []string
+	if value := r.URL.Query().Get("types"); value != "" {
+		types = strings.Split(value, ",")
+	}
+	holder := r.Header.Get("Authorization")
+
+	for {
+		s.mu.Lock()
+		s.expireLeases()
+		for i, id := range s.queue {
+			t := s.tasks[id]
+			if workerType, ok := t.task.ConversionType(); len(types) > 0 && (!ok || !slices.Contains(types, string(workerType))) {
+				continue
+			}
+			s.queue = slices.Delete(s.queue, i, i+1)
+			t.holder = holder
+			t.expiry = time.Now().Add(s.leaseDuration)
+			s.leased[id] = t
+			t.setStatus(models.TaskStatusProcessing)
+			task := t.task
+			s.mu.Unlock()
+			respond(w, http.StatusOK, task)
+			return
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			fail(w, http.StatusNotFound, "No pending task")
+			return
+		}
+		// Expired leases are only noticed when polling, so waits are bounded by the lease duration.
+		timer := time.NewTimer(min(remaining, s.leaseDuration))
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+func (s *Server) updateStatus(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateTaskStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, status := s.held(r)
+	if t == nil {
+		fail(w, status, "Task is not assigned to this worker")
+		return
+	}
+	switch req.Status {
+	case models.TaskStatusPending:
+		s.release(t)
+		t.setStatus(models.TaskStatusPending)
+		s.enqueue(t.task.ID)
+	case models.TaskStatusCompleted, models.TaskStatusFailed:
+		s.release(t)
+		t.setStatus(req.Status)
+	}
+	respond(w, http.StatusOK, nil)
+}
+
+func (s *Server) renewLease(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, status := s.held(r)
+	if t == nil {
+		fail(w, status, "Task is not assigned to this worker")
+		return
+	}
+	t.expiry = time.Now().Add(s.leaseDuration)
+	respond(w, http.StatusOK, models.TaskLease{TaskID: t.task.ID, ExpiresAt: t.expiry})
+}
+
+func (s *Server) uploadResult(w http.ResponseWriter, r *http.Request) {
+	// The result is read before taking the lock, as it may be streamed slowly.
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		fail(w, http.StatusBadRequest, "Invalid result")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, status := s.held(r)
+	if t == nil {
+		fail(w, status, "Task is not assigned to this worker")
+		return
+	}
+	resultID := s.nextID("file")
+	s.release(t)
+	t.setStatus(models.TaskStatusCompleted)
+	t.task.ResultFileID = &resultID
+	respond(w, http.StatusOK, models.File{ID: resultID})
+}
+
+// held returns the task of the request if it is assigned to the requesting worker, or the
+// status explaining why it is not; s.mu must be held.
+func (s *Server) held(r *http.Request) (*simTask, int) {
+	s.expireLeases()
+	t, ok := s.tasks[r.PathValue("id")]
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+	if t.holder == "" || t.holder != r.Header.Get("Authorization") {
+		return nil, http.StatusConflict
+	}
+	return t, 0
+}
+
+// expireLeases queues the tasks whose lease has expired again; s.mu must be held.
+func (s *Server) expireLeases() {
+	now := time.Now()
+	for id, t := range s.leased {
+		if now.After(t.expiry) {
+			s.release(t)
+			t.setStatus(models.TaskStatusPending)
+			s.enqueue(id)
+		}
+	}
+}
+
+// release ends the assignment of a task; s.mu must be held.
+func (s *Server) release(t *simTask) {
+	t.holder = ""
+	delete(s.leased, t.task.ID)
+}
+
+// enqueue appends a task to the queue and wakes the waiting claims; s.mu must be held.
+func (s *Server) enqueue(id string) {
+	s.queue = append(s.queue, id)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// nextID returns a new identifier; s.mu must be held.
+func (s *Server) nextID(prefix string) string {
+	s.ids++
+	return fmt.Sprintf("%s-%d", prefix, s.ids)
+}
+
+func fileMetadata(id, filename string, data []byte) models.File {
+	now := time.Now().UTC()
+	return models.File{ID: id, Filename: filename, Size: int64(len(data)), Hash: fmt.Sprintf("%x", sha256.Sum256(data)), CreatedAt: now, UpdatedAt: now}
+}
+
+func respond(w http.ResponseWriter, status int, data interface{}) {
+	resp := models.APIResponse{Success: true}
+	if data != nil {
+		resp.Data = &data
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func fail(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(models.APIErrorResponse{Success: false, Message: message})
+}
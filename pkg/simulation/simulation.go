@@ -0,0 +1,462 @@
+// Package simulation load-tests the task queue with simulated workers.
+// Workers use the real API clients to claim tasks and report their outcome, while synthetic
+// handlers stand in for the conversions. Run can target an existing API or a local Server.
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/analysis"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
+)
+
+const (
+	defaultPollInterval = 50 * time.Millisecond
+	defaultSourceSize   = 1 << 10
+	// maxUploadAttempts bounds the attempts to upload the source file of the tasks and to create each worker.
+	maxUploadAttempts = 5
+)
+
+// Config describes a simulation.
+type Config struct {
+	// BaseURL is the API under test; empty starts a local Server for the duration of the run.
+	BaseURL   string
+	UserToken string // Creates the tasks, and the workers without RegistrationTokens
+	// RegistrationTokens registers the workers, one single-use token each; empty creates a worker
+	// per simulated worker with UserToken, deleted at the end of the run.
+	RegistrationTokens []string
+
+	Workers  int
+	Tasks    int           // Number of tasks generated
+	TaskRate float64       // Tasks created per second; zero creates them all before the workers start
+	Config   interface{}   // Configuration of the generated tasks; nil creates image conversions
+	Source   int           // Size of the source file of the tasks, downloaded by the workers; zero defaults to 1KB
+	Timeout  time.Duration // Stops the run if the tasks are not all finished by then; zero waits for ctx only
+
+	TaskDuration time.Duration // Time spent by the synthetic handler on a task
+	Jitter       time.Duration // Added to TaskDuration, drawn uniformly from [0, Jitter)
+	FailureRate  float64       // Share of the tasks failed by the synthetic handler, from 0 to 1
+
+	PollWait          time.Duration // Long-poll duration of the claims
+	PollInterval      time.Duration // Pause after an empty or failed claim; zero defaults to 50ms
+	HeartbeatInterval time.Duration // Zero disables heartbeats
+	Seed              uint64        // Seeds the synthetic handlers, for reproducible runs
+}
+
+// Run creates the tasks of the simulation, processes them with cfg.Workers simulated workers
+// and reports the measurements once every task is finished. If ctx is done or the timeout
+// expires first, the partial report is returned along with the cause.
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	if cfg.Workers <= 0 || cfg.Tasks <= 0 {
+		return nil, errors.New("simulation: at least one worker and one task are required")
+	}
+	if len(cfg.RegistrationTokens) > 0 && len(cfg.RegistrationTokens) < cfg.Workers {
+		return nil, fmt.Errorf("simulation: %d registration tokens for %d workers", len(cfg.RegistrationTokens), cfg.Workers)
+	}
+	if cfg.BaseURL == "" {
+		server := NewServer()
+		defer server.Close()
+		cfg.BaseURL = server.URL()
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.Source <= 0 {
+		cfg.Source = defaultSourceSize
+	}
+	if cfg.Config == nil {
+		cfg.Config = map[string]interface{}{"type": models.WorkerTypeImage, "format": "png"}
+	}
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cfg.Timeout, errors.New("simulation: timed out"))
+		defer cancel()
+	}
+
+	s := &simulation{
+		cfg:       cfg,
+		transport: &http.Transport{MaxIdleConnsPerHost: cfg.Workers + 1},
+		claimed:   make(map[string]bool),
+		outcomes:  make(map[string]bool),
+		holders:   make(map[string]int),
+		errors:    make(map[string]int),
+		finished:  make(chan struct{}),
+	}
+	defer s.transport.CloseIdleConnections()
+	return s.run(ctx)
+}
+
+// simulation holds the state and the measurements of a run.
+type simulation struct {
+	cfg       Config
+	transport *http.Transport // Shared by the clients, as a fleet would keep its connections open
+
+	mu         sync.Mutex
+	claimed    map[string]bool // Tasks claimed at least once
+	outcomes   map[string]bool // Whether each finished task completed
+	holders    map[string]int  // Worker currently processing each task
+	claims     []time.Duration
+	queueTimes []time.Duration
+	requests   int
+	errors     map[string]int // Failed requests per operation
+	completed  int
+	failed     int
+	duplicates int
+	leasesLost int
+	lastFinish time.Time
+	finished   chan struct{}
+}
+
+func (s *simulation) run(ctx context.Context) (*Report, error) {
+	start := time.Now()
+	admin := s.client(s.cfg.UserToken)
+	var source *models.File
+	var err error
+	for attempt := 0; source == nil; attempt++ {
+		source, err = admin.Files.UploadFile(ctx, "simulation.bin", make([]byte, s.cfg.Source))
+		s.observe("upload", err)
+		if err != nil && (attempt == maxUploadAttempts-1 || !sleep(ctx, s.cfg.PollInterval)) {
+			return nil, fmt.Errorf("simulation: failed to upload the source file: %w", err)
+		}
+	}
+
+	tokens := s.cfg.RegistrationTokens
+	if len(tokens) == 0 {
+		var workers []string
+		workers, tokens, err = s.createWorkers(ctx, admin)
+		defer s.deleteWorkers(context.WithoutCancel(ctx), admin, workers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	if s.cfg.TaskRate <= 0 {
+		s.generate(ctx, admin, source.ID)
+	} else {
+		wg.Go(func() { s.generate(ctx, admin, source.ID) })
+	}
+	for i := range s.cfg.Workers {
+		wg.Go(func() { s.work(ctx, i, tokens[i]) })
+	}
+
+	select {
+	case <-s.finished:
+	case <-ctx.Done():
+	}
+	err = context.Cause(ctx)
+	cancel()
+	wg.Wait()
+	return s.report(start), err
+}
+
+// generate creates the tasks, at the configured rate if any.
+func (s *simulation) generate(ctx context.Context, admin *clients.Client, fileID string) {
+	var tick <-chan time.Time
+	if s.cfg.TaskRate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / s.cfg.TaskRate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	config := s.cfg.Config
+	for created := 0; created < s.cfg.Tasks; {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				return
+			}
+		}
+		_, err := admin.Tasks.CreateTask(ctx, models.CreateTaskRequest{FileID: fileID, Config: &config})
+		s.observe("create", err)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if tick == nil {
+				sleep(ctx, s.cfg.PollInterval)
+			}
+			continue
+		}
+		created++
+	}
+}
+
+// createWorkers creates a worker per simulated worker and returns their IDs and registration tokens.
+func (s *simulation) createWorkers(ctx context.Context, admin *clients.Client) (ids, tokens []string, err error) {
+	capabilities := []string{string(models.WorkerTypeImage), string(models.WorkerTypeVideo)}
+	for i, attempt := 0, 0; i < s.cfg.Workers; attempt++ {
+		worker, err := admin.Workers.CreateWorker(ctx, fmt.Sprintf("simulated-worker-%d", i), capabilities)
+		s.observe("create-worker", err)
+		if err == nil && (worker.Token == nil || *worker.Token == "") {
+			return ids, tokens, fmt.Errorf("simulation: no registration token returned for worker %s", worker.ID)
+		}
+		if err != nil {
+			if attempt == maxUploadAttempts-1 || !sleep(ctx, s.cfg.PollInterval) {
+				return ids, tokens, fmt.Errorf("simulation: failed to create the workers: %w", err)
+			}
+			continue
+		}
+		ids = append(ids, worker.ID)
+		tokens = append(tokens, *worker.Token)
+		i, attempt = i+1, -1
+	}
+	return ids, tokens, nil
+}
+
+// deleteWorkers removes the workers created for the run, best effort.
+func (s *simulation) deleteWorkers(ctx context.Context, admin *clients.Client, ids []string) {
+	for _, id := range ids {
+		_ = admin.Workers.DeleteWorker(ctx, id)
+	}
+}
+
+// work runs a simulated worker, registered with token, until ctx is done.
+func (s *simulation) work(ctx context.Context, id int, token string) {
+	client := s.client("")
+	for {
+		resp, err := client.Workers.RegisterWorker(ctx, token)
+		s.observe("register", err)
+		if err == nil {
+			client.SetToken(resp.Data.Token)
+			break
+		}
+		if !sleep(ctx, s.cfg.PollInterval) {
+			return
+		}
+	}
+	if s.cfg.HeartbeatInterval > 0 {
+		go s.heartbeat(ctx, client)
+	}
+
+	rng := rand.New(rand.NewPCG(s.cfg.Seed, uint64(id)))
+	for ctx.Err() == nil {
+		claimed := time.Now()
+		task, err := claim(ctx, client, s.cfg.PollWait)
+		if errors.Is(err, sdkerrors.ErrNoPendingTask) {
+			s.observe("claim", nil)
+			sleep(ctx, s.cfg.PollInterval)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		s.observe("claim", err)
+		if err != nil {
+			sleep(ctx, s.cfg.PollInterval)
+			continue
+		}
+		s.claim(id, task, time.Since(claimed))
+		s.process(ctx, client, rng, id, task)
+	}
+}
+
+// process runs the synthetic handler on a claimed task and reports its outcome.
+func (s *simulation) process(ctx context.Context, client *clients.Client, rng *rand.Rand, id int, task *models.Task) {
+	defer s.release(id, task.ID)
+
+	err := client.Tasks.UpdateTaskStatus(ctx, task.ID, models.UpdateTaskStatusRequest{Status: models.TaskStatusProcessing, StatusMessage: "Task accepted by worker"})
+	if s.abandon(ctx, client, task, "status", err) {
+		return
+	}
+	if task.SourceFileID != nil {
+		_, err := client.Files.DownloadFile(ctx, *task.SourceFileID)
+		if s.abandon(ctx, client, task, "download", err) {
+			return
+		}
+	}
+
+	duration := s.cfg.TaskDuration
+	if s.cfg.Jitter > 0 {
+		duration += time.Duration(rng.Int64N(int64(s.cfg.Jitter)))
+	}
+	if !sleep(ctx, duration) {
+		return
+	}
+
+	if rng.Float64() < s.cfg.FailureRate {
+		err = client.Tasks.UpdateTaskStatus(ctx, task.ID, models.UpdateTaskStatusRequest{Status: models.TaskStatusFailed, StatusMessage: "simulated failure"})
+		if !s.abandon(ctx, client, task, "status", err) {
+			s.finish(task.ID, false)
+		}
+		return
+	}
+	err = client.Tasks.UploadTaskResult(ctx, task.ID, "result.bin", []byte(task.ID))
+	if !s.abandon(ctx, client, task, "result", err) {
+		s.finish(task.ID, true)
+	}
+}
+
+// claim polls a pending task, waiting for up to wait when the task service supports long polling.
+func claim(ctx context.Context, client *clients.Client, wait time.Duration) (*models.Task, error) {
+	if tasks, ok := client.Tasks.(services.TaskWorkerService); ok {
+		return tasks.GetPendingTaskWithOptions(ctx, models.PendingTaskOptions{Wait: wait})
+	}
+	return client.Tasks.GetPendingTask(ctx)
+}
+
+func (s *simulation) heartbeat(ctx context.Context, client *clients.Client) {
+	workers, ok := client.Workers.(services.HeartbeatService)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(s.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := workers.Heartbeat(ctx, models.HeartbeatRequest{Status: models.WorkerStatusOnline})
+			if ctx.Err() != nil {
+				return
+			}
+			s.observe("heartbeat", err)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// client creates an API client sharing the connections of the simulation.
+func (s *simulation) client(token string) *clients.Client {
+	client := clients.NewClient(s.cfg.BaseURL, token)
+	client.HTTPClient.Transport = s.transport
+	return client
+}
+
+// observe counts a request and its failure, if any. Requests interrupted by the end of the run are ignored.
+func (s *simulation) observe(operation string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if err != nil {
+		s.errors[operation]++
+	}
+}
+
+// abandon observes a request on a claimed task and reports whether the task must be abandoned.
+// Unless its lease was lost, the task is handed back so that another worker processes it
+// without waiting for the lease to expire.
+func (s *simulation) abandon(ctx context.Context, client *clients.Client, task *models.Task, operation string, err error) bool {
+	s.observe(operation, err)
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, sdkerrors.ErrLeaseLost):
+		s.mu.Lock()
+		s.leasesLost++
+		s.mu.Unlock()
+	case ctx.Err() == nil:
+		err := client.Tasks.UpdateTaskStatus(ctx, task.ID, models.UpdateTaskStatusRequest{Status: models.TaskStatusPending, StatusMessage: "handed back by simulated worker"})
+		s.observe("handback", err)
+	}
+	return true
+}
+
+// claim records that worker id claimed the task. A task claimed while another worker is still
+// processing it is a duplicate assignment.
+func (s *simulation) claim(id int, task *models.Task, latency time.Duration) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims = append(s.claims, latency)
+	if !s.claimed[task.ID] && task.CreatedAt != nil {
+		s.queueTimes = append(s.queueTimes, now.Sub(*task.CreatedAt))
+	}
+	s.claimed[task.ID] = true
+	if holder, ok := s.holders[task.ID]; ok && holder != id {
+		s.duplicates++
+	}
+	s.holders[task.ID] = id
+}
+
+// release records that worker id stopped processing the task.
+func (s *simulation) release(id int, taskID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holders[taskID] == id {
+		delete(s.holders, taskID)
+	}
+}
+
+// finish counts a task reported as completed or failed, and ends the run once all are.
+// A task finished twice, after a duplicate claim, is counted once; the API under test may hold
+// other tasks, so the run ends once at least cfg.Tasks are finished.
+func (s *simulation) finish(taskID string, completed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.outcomes[taskID]; ok {
+		return
+	}
+	s.outcomes[taskID] = completed
+	if completed {
+		s.completed++
+	} else {
+		s.failed++
+	}
+	s.lastFinish = time.Now()
+	if len(s.outcomes) >= s.cfg.Tasks {
+		select {
+		case <-s.finished:
+		default:
+			close(s.finished)
+		}
+	}
+}
+
+func (s *simulation) report(start time.Time) *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := &Report{
+		Workers:         s.cfg.Workers,
+		Tasks:           s.cfg.Tasks,
+		Completed:       s.completed,
+		Failed:          s.failed,
+		Duration:        time.Since(start),
+		ClaimLatency:    analysis.NewDurationStats(s.claims),
+		QueueTime:       analysis.NewDurationStats(s.queueTimes),
+		Requests:        s.requests,
+		ErrorsByRequest: make(map[string]int, len(s.errors)),
+		DuplicateClaims: s.duplicates,
+		LeasesLost:      s.leasesLost,
+	}
+	for operation, n := range s.errors {
+		r.ErrorsByRequest[operation] = n
+		r.Errors += n
+	}
+	if s.requests > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(s.requests)
+	}
+	if finished := r.Completed + r.Failed; finished > 0 {
+		r.Throughput = float64(finished) / s.lastFinish.Sub(start).Seconds()
+	}
+	return r
+}
+
+// sleep waits for d and reports whether ctx is still running.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes how long the Runner waits before polling again when the queue is empty or the API fails.
+type Backoff interface {
+	// Next returns the delay before the next poll.
+	Next() time.Duration
+	// Reset is called once a task has been claimed.
+	Reset()
+}
+
+// ConstantBackoff always waits the same delay.
+type ConstantBackoff time.Duration
+
+// Next returns the constant delay.
+func (b ConstantBackoff) Next() time.Duration {
+	return time.Duration(b)
+}
+
+// Reset does nothing.
+func (b ConstantBackoff) Reset() {}
+
+// ExponentialBackoff doubles the delay after each idle poll, from Min up to Max.
+// Jitter, between 0 and 1, randomly shortens each delay by up to that fraction
+// so that idle workers do not poll in lockstep.
+type ExponentialBackoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Jitter float64
+
+	current time.Duration
+}
+
+// NewExponentialBackoff creates an ExponentialBackoff with a 20% jitter.
+func NewExponentialBackoff(minDelay, maxDelay time.Duration) *ExponentialBackoff {
+	return &ExponentialBackoff{Min: minDelay, Max: maxDelay, Jitter: 0.2}
+}
+
+// Next returns the current delay and doubles it for the following call.
+func (b *ExponentialBackoff) Next() time.Duration {
+	if b.current < b.Min {
+		b.current = b.Min
+	}
+	d := b.current
+	b.current = min(b.current*2, b.Max)
+	if b.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * b.Jitter * float64(d))
+	}
+	return d
+}
+
+// Reset restarts the sequence from Min.
+func (b *ExponentialBackoff) Reset() {
+	b.current = 0
+}
@@ -0,0 +1,252 @@
+package worker
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// cacheMetaSuffix names the metadata file stored next to each cached result.
+const cacheMetaSuffix = ".json"
+
+// cacheEntry describes a cached result.
+type cacheEntry struct {
+	Key      string    `json:"key"`
+	Filename string    `json:"filename"`
+	Size     int64     `json:"size"` // Of all the outputs
+	LastUsed time.Time `json:"lastUsed"`
+
+	Attachments []string               `json:"attachments,omitempty"` // Filenames, the data being stored in <key>.<index>
+	Metadata    *models.ResultMetadata `json:"metadata,omitempty"`
+}
+
+// paths returns the files holding the outputs of the entry.
+func (e *cacheEntry) paths(dir string) []string {
+	paths := []string{filepath.Join(dir, e.Key)}
+	for i := range e.Attachments {
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("%s.%d", e.Key, i+1)))
+	}
+	return paths
+}
+
+// resultCache stores the results produced by handlers in dir, keyed by the hash of the
+// source file and the canonical configuration of the task. The least recently used results
+// are evicted once the cache exceeds maxBytes, except those being uploaded.
+type resultCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Values are *cacheEntry, most recently used first
+	lru     *list.List
+	size    int64
+	pins    map[string]int // Results returned by get and not released yet, which are not evicted
+}
+
+func newResultCache(dir string, maxBytes int64) *resultCache {
+	return &resultCache{dir: dir, maxBytes: maxBytes, entries: make(map[string]*list.Element), lru: list.New(), pins: make(map[string]int)}
+}
+
+// cacheKey returns the key of the result of job, or "" if it cannot be cached.
+func cacheKey(job *Job) string {
+	if job.Source == nil || job.Source.Hash == "" {
+		return ""
+	}
+	var config interface{}
+	if job.Task.Config != nil {
+		if err := job.Task.DecodeConfig(&config); err != nil {
+			return ""
+		}
+	}
+	// Maps are marshalled with sorted keys, which makes the configuration canonical.
+	canonical, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n%s\n%s", job.Type, job.Source.Hash, canonical)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// load indexes the results left by a previous run.
+func (c *resultCache) load() error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("worker: failed to create result cache: %w", err)
+	}
+	metas, err := filepath.Glob(filepath.Join(c.dir, "*"+cacheMetaSuffix))
+	if err != nil {
+		return err
+	}
+	var entries []*cacheEntry
+	for _, path := range metas {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		entry := &cacheEntry{}
+		if json.Unmarshal(data, entry) != nil || entry.Key != strings.TrimSuffix(filepath.Base(path), cacheMetaSuffix) {
+			continue
+		}
+		if !exist(entry.paths(c.dir)) {
+			c.removeFiles(entry)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b *cacheEntry) int { return b.LastUsed.Compare(a.LastUsed) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range entries {
+		c.entries[entry.Key] = c.lru.PushBack(entry)
+		c.size += entry.Size
+	}
+	c.evict()
+	return nil
+}
+
+// get returns the cached result of key, whose outputs are read from the cache directory.
+// The result is not evicted until release is called, once its outputs are no longer read.
+func (c *resultCache) get(key string) (result *Result, release func(), ok bool) {
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return nil, nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	c.lru.MoveToFront(elem)
+	entry.LastUsed = time.Now().UTC()
+	meta := *entry
+	c.pins[key]++
+	c.mu.Unlock()
+
+	release = func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.pins[key]--; c.pins[key] == 0 {
+			delete(c.pins, key)
+		}
+		c.evict()
+	}
+	paths := meta.paths(c.dir)
+	if !exist(paths) {
+		release()
+		c.remove(key)
+		return nil, nil, false
+	}
+	_ = c.writeMeta(&meta)
+	outputs := []Output{{Filename: meta.Filename, Path: paths[0]}}
+	for i, filename := range meta.Attachments {
+		outputs = append(outputs, Output{Filename: filename, Path: paths[i+1]})
+	}
+	return newResult(outputs, meta.Metadata), release, true
+}
+
+// put stores the result of key; results larger than the whole cache are not stored.
+func (c *resultCache) put(key string, result *Result) error {
+	outputs := result.outputs()
+	var size int64
+	for _, o := range outputs {
+		n, err := o.size()
+		if err != nil {
+			return err
+		}
+		size += n
+	}
+	if size > c.maxBytes {
+		return nil
+	}
+	entry := &cacheEntry{Key: key, Filename: result.Filename, Size: size, LastUsed: time.Now().UTC(), Metadata: result.Metadata}
+	for _, o := range outputs[1:] {
+		entry.Attachments = append(entry.Attachments, o.Filename)
+	}
+	for i, path := range entry.paths(c.dir) {
+		if _, err := storeOutput(path, outputs[i]); err != nil {
+			return err
+		}
+	}
+	if err := c.writeMeta(entry); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*cacheEntry).Size
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+	c.evict()
+	return nil
+}
+
+// remove drops the result of key.
+func (c *resultCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.drop(elem)
+	}
+}
+
+// evict drops the least recently used results until the cache fits, skipping the pinned ones;
+// c.mu must be held.
+func (c *resultCache) evict() {
+	for elem := c.lru.Back(); elem != nil && c.size > c.maxBytes; {
+		prev := elem.Prev()
+		if c.pins[elem.Value.(*cacheEntry).Key] == 0 {
+			c.drop(elem)
+		}
+		elem = prev
+	}
+}
+
+// drop removes an entry and its files; c.mu must be held.
+func (c *resultCache) drop(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.Key)
+	c.size -= entry.Size
+	c.removeFiles(entry)
+}
+
+// removeFiles removes the outputs and the metadata of an entry.
+func (c *resultCache) removeFiles(entry *cacheEntry) {
+	for _, path := range entry.paths(c.dir) {
+		_ = os.Remove(path)
+	}
+	_ = os.Remove(c.path(entry.Key) + cacheMetaSuffix)
+}
+
+func (c *resultCache) writeMeta(entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path(entry.Key)+cacheMetaSuffix, data, 0o600)
+}
+
+func (c *resultCache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+// exist reports whether all the files exist.
+func exist(paths []string) bool {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
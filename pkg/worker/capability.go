@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// ErrUnsupportedTask is returned for claimed tasks the worker cannot process.
+var ErrUnsupportedTask = errors.New("worker: unsupported task")
+
+// ConfigValidator is implemented by handlers that only support part of the configurations of their type.
+// ValidateConfig is called with tasks whose configuration is valid for the API.
+type ConfigValidator interface {
+	ValidateConfig(task *models.Task) error
+}
+
+// Capabilities returns the task types the Runner has a handler for.
+func (r *Runner) Capabilities() []models.WorkerType {
+	return slices.Sorted(maps.Keys(r.handlers))
+}
+
+// check verifies that the Runner can process a claimed task and returns its type.
+func (r *Runner) check(task *models.Task) (models.WorkerType, error) {
+	workerType, err := task.ValidateConfig()
+	if err != nil {
+		return workerType, fmt.Errorf("%w: %w", ErrUnsupportedTask, err)
+	}
+	if _, ok := r.handlers[workerType]; !ok {
+		return workerType, fmt.Errorf("%w: no handler for task type %q (capabilities: %v)", ErrUnsupportedTask, workerType, r.Capabilities())
+	}
+	if v, ok := r.validators[workerType]; ok {
+		if err := v.ValidateConfig(task); err != nil {
+			return workerType, fmt.Errorf("%w: %w", ErrUnsupportedTask, err)
+		}
+	}
+	return workerType, nil
+}
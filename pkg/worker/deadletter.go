@@ -0,0 +1,207 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+const (
+	failuresFile = "failures.json"
+	// failureRetention is how long the failures of a task are remembered after the last one.
+	failureRetention = 7 * 24 * time.Hour
+	// failurePrefix starts the status message of a task whose handler failed, whether it is
+	// handed back for a retry or reported as failed.
+	failurePrefix = "processing failed: "
+	// diagnosticsFilename names the diagnostic bundle uploaded as the result of a dead-lettered task.
+	diagnosticsFilename = "diagnostics.json"
+)
+
+// Diagnostics is the bundle of a dead-lettered task, uploaded as its result file for inspection
+// and given to the DiagnosticsSink, if any.
+type Diagnostics struct {
+	TaskID   string            `json:"taskId"`
+	Instance string            `json:"instance"`
+	Type     models.WorkerType `json:"type"`
+	Failures int               `json:"failures"`
+	Error    string            `json:"error"`
+	Stderr   string            `json:"stderr,omitempty"` // Tail of the standard error of the handler, see ExecError
+	Config   interface{}       `json:"config,omitempty"`
+	Source   *models.File      `json:"source,omitempty"`
+	Version  string            `json:"version,omitempty"` // Of the worker, see WithVersion
+	FailedAt time.Time         `json:"failedAt"`
+}
+
+// DiagnosticsSink stores the diagnostic bundle of a dead-lettered task, see WithDiagnosticsSink.
+type DiagnosticsSink func(ctx context.Context, diag *Diagnostics) error
+
+// DiagnosticsDir returns a DiagnosticsSink writing each bundle to dir/<instance>/<task>.json.
+func DiagnosticsDir(dir string) DiagnosticsSink {
+	return func(ctx context.Context, diag *Diagnostics) error {
+		data, err := json.MarshalIndent(diag, "", "  ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, diag.Instance, diag.TaskID+".json")
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return err
+		}
+		return writeFileAtomic(path, data, 0o600)
+	}
+}
+
+// failureCount is the number of failures of a task recorded by the worker.
+type failureCount struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+}
+
+// failureLog persists the failures of tasks on this worker, so that they are counted across
+// restarts and when the logs of a task cannot be read.
+type failureLog struct {
+	path string
+
+	mu     sync.Mutex
+	counts map[string]failureCount // Keyed by run.key
+}
+
+func newFailureLog(dir string) *failureLog {
+	return &failureLog{path: filepath.Join(dir, failuresFile), counts: make(map[string]failureCount)}
+}
+
+// load reads the failures recorded by a previous run, forgetting those past the retention.
+func (l *failureLog) load() error {
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("worker: failed to read failure log: %w", err)
+	}
+	counts := make(map[string]failureCount)
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return fmt.Errorf("worker: failed to decode failure log: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, c := range counts {
+		if time.Since(c.LastFailure) < failureRetention {
+			l.counts[key] = c
+		}
+	}
+	return nil
+}
+
+func (l *failureLog) get(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.counts[key].Failures
+}
+
+// set records the number of failures of a task; zero forgets the task.
+func (l *failureLog) set(key string, failures int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if failures == 0 {
+		if _, ok := l.counts[key]; !ok {
+			return nil
+		}
+		delete(l.counts, key)
+	} else {
+		l.counts[key] = failureCount{Failures: failures, LastFailure: time.Now().UTC()}
+	}
+	data, err := json.Marshal(l.counts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(l.path, data, 0o600)
+}
+
+// failures returns the number of times a task has failed before: the failures in the status
+// history embedded in the task when it was claimed, on any worker, or the failures recorded by
+// this worker when there are more of them, the API not always returning the history.
+func (r *Runner) failures(t *run) int {
+	failed := 0
+	for _, l := range t.task.Logs {
+		if l.TaskStatus == models.TaskStatusFailed || strings.HasPrefix(l.Message, failurePrefix) {
+			failed++
+		}
+	}
+	return max(failed, r.failureLog.get(t.key()))
+}
+
+// fail reports a task whose handler failed. With WithDeadLetter, the task is handed back as pending
+// for a retry until it reaches the threshold; it is then dead-lettered: its diagnostic bundle is
+// uploaded as its result file and given to the DiagnosticsSink, then it is reported as failed.
+func (r *Runner) fail(ctx context.Context, t *run, job *Job, err error) {
+	message := failurePrefix + err.Error()
+	// A task interrupted by a shutdown or a lost lease has not failed on its own.
+	if r.failureLog == nil || ctx.Err() != nil {
+		r.finish(ctx, t, models.TaskStatusFailed, message)
+		return
+	}
+	logger := r.logger.With("task", t.task.ID, "instance", t.inst.Name)
+	failures := r.failures(t) + 1
+	if failures < r.deadLetterThreshold {
+		if err := r.failureLog.set(t.key(), failures); err != nil {
+			logger.Warn("failed to record task failure", "error", err)
+		}
+		logger.Warn("handing back failed task for a retry", "failures", failures, "reason", message)
+		r.finish(ctx, t, models.TaskStatusPending, message)
+		return
+	}
+
+	logger.Warn("dead-lettering task", "failures", failures)
+	diag := Diagnostics{
+		TaskID:   t.task.ID,
+		Instance: t.inst.Name,
+		Type:     t.workerType,
+		Failures: failures,
+		Error:    err.Error(),
+		Config:   t.task.Config,
+		Source:   job.Source,
+		Version:  r.version,
+		FailedAt: time.Now().UTC(),
+	}
+	var execErr *ExecError
+	if errors.As(err, &execErr) {
+		diag.Stderr = execErr.Stderr
+	}
+	if r.diagnosticsSink != nil {
+		if err := r.diagnosticsSink(ctx, &diag); err != nil {
+			logger.Error("failed to store diagnostics", "error", err)
+		}
+	}
+	if err := r.failureLog.set(t.key(), 0); err != nil {
+		logger.Warn("failed to record task failure", "error", err)
+	}
+	bundle, err := json.MarshalIndent(diag, "", "  ")
+	if err == nil {
+		err = t.inst.uploadResult(ctx, t.task.ID, &Result{Filename: diagnosticsFilename, Data: bundle})
+	}
+	switch {
+	case errors.Is(err, sdkerrors.ErrLeaseLost):
+		r.loseLease(t)
+		return
+	case err != nil:
+		logger.Error("failed to upload diagnostics", "error", err, "diagnostics", diag)
+	}
+	if !t.settle() {
+		return
+	}
+	r.count(t, failedTasks)
+	r.count(t, deadLetteredTasks)
+	r.report(ctx, t.inst, t.task.ID, models.TaskStatusFailed, truncate(fmt.Sprintf("dead-lettered after %d failures: %s", failures, message), maxStatusMessageLength))
+}
@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
+)
+
+// Credentials are the tokens of an enrolled worker, persisted between restarts.
+type Credentials struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// LoadCredentials reads the credentials file at path.
+// The error wraps os.ErrNotExist when the worker has not been enrolled yet.
+func LoadCredentials(path string) (*Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("worker: failed to read credentials: %w", err)
+	}
+	creds := &Credentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("worker: failed to decode credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// SaveCredentials atomically writes creds to path, readable by the current user only.
+func SaveCredentials(path string, creds *Credentials) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("worker: failed to create credentials directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0o600); err != nil {
+		return fmt.Errorf("worker: failed to write credentials: %w", err)
+	}
+	return nil
+}
+
+// Enroll authenticates client with the credentials stored at path.
+// Existing credentials are renewed with RefreshAuth when they hold a refresh token, which the
+// documented API does not issue, and are otherwise used as is. The one-time registration token is
+// only exchanged when no credentials file exists yet. The new tokens are saved before being returned.
+func Enroll(ctx context.Context, client *clients.Client, path, registrationToken string) (*Credentials, error) {
+	creds, err := LoadCredentials(path)
+	switch {
+	case err == nil && creds.RefreshToken == "":
+		if creds.Token == "" {
+			return nil, fmt.Errorf("worker: stored credentials hold no token: %s", path)
+		}
+		client.SetToken(creds.Token)
+		return creds, nil
+	case err == nil:
+		resp, err := client.Workers.RefreshAuth(ctx, creds.RefreshToken)
+		if err != nil {
+			return nil, fmt.Errorf("worker: failed to refresh stored credentials: %w", err)
+		}
+		creds.Token = resp.Data.Token
+		if resp.Data.RefreshToken != "" {
+			creds.RefreshToken = resp.Data.RefreshToken
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if registrationToken == "" {
+			return nil, errors.New("worker: not enrolled and no registration token provided")
+		}
+		// The registration token can only be used once: make sure the credentials can be saved first.
+		if err := checkWritable(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("worker: cannot save credentials: %w", err)
+		}
+		resp, err := client.Workers.RegisterWorker(ctx, registrationToken)
+		if err != nil {
+			return nil, fmt.Errorf("worker: failed to register: %w", err)
+		}
+		creds = &Credentials{Token: resp.Data.Token, RefreshToken: resp.Data.RefreshToken}
+	default:
+		return nil, err
+	}
+
+	creds.UpdatedAt = time.Now().UTC()
+	if err := SaveCredentials(path, creds); err != nil {
+		return nil, err
+	}
+	client.SetToken(creds.Token)
+	return creds, nil
+}
+
+// checkWritable creates dir if needed and checks that files can be created in it.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,315 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+const (
+	// stderrTailSize is the amount of standard error kept to explain a failure.
+	stderrTailSize = 4 << 10
+	// defaultKillDelay is how long pipes may stay open once the process has exited or been killed,
+	// for instance by a background process that inherited them.
+	defaultKillDelay = 5 * time.Second
+	// maxMessageSize bounds the lines of standard output decoded as messages; longer lines are skipped.
+	maxMessageSize = 1 << 20
+)
+
+// ExecRequest is the JSON document written on the standard input of an external handler.
+type ExecRequest struct {
+	TaskID         string            `json:"taskId"`
+	Type           models.WorkerType `json:"type"`
+	Config         json.RawMessage   `json:"config"`
+	SourcePath     string            `json:"sourcePath"`
+	SourceFilename string            `json:"sourceFilename"`
+	OutputDir      string            `json:"outputDir"`
+}
+
+// ExecMessage is a line written by an external handler on its standard output.
+// Type is "progress" (Percent, Message), "result" (Path, Filename, Attachments, Metadata)
+// or "error" (Message).
+type ExecMessage struct {
+	Type     string  `json:"type"`
+	Percent  float64 `json:"percent,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Path     string  `json:"path,omitempty"`
+	Filename string  `json:"filename,omitempty"`
+
+	Attachments []string               `json:"attachments,omitempty"` // Paths of additional outputs
+	Metadata    *models.ResultMetadata `json:"metadata,omitempty"`
+}
+
+// ExecHandler runs an external command for every task.
+// The command receives an ExecRequest on its standard input and writes ExecMessage lines on its
+// standard output; lines that are not JSON are ignored. The output files named by the "result"
+// message are uploaded: their paths are relative to the output directory and must name regular
+// files inside it, symbolic links included.
+// The command runs in its own process group, which is killed when the task is cancelled.
+type ExecHandler struct {
+	Command string
+	Args    []string
+	Env     []string      // Added to the environment of the worker
+	Timeout time.Duration // Zero relies on the task deadlines of the Runner
+	Sandbox *Sandbox      // Restricts the command; nil runs it with the environment and rights of the worker
+}
+
+// NewExecHandler creates an ExecHandler running command with args.
+func NewExecHandler(command string, args ...string) *ExecHandler {
+	return &ExecHandler{Command: command, Args: args}
+}
+
+// Handle implements Handler.
+func (h *ExecHandler) Handle(ctx context.Context, job *Job) (*Result, error) {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, h.Timeout, ErrTaskTimeout)
+		defer cancel()
+	}
+
+	dir := job.Dir
+	env := append(os.Environ(), h.Env...)
+	if h.Sandbox != nil {
+		var err error
+		if dir, err = h.Sandbox.workDir(job); err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		env = h.Sandbox.environ(dir, h.Env)
+	}
+
+	req := ExecRequest{
+		TaskID:     job.Task.ID,
+		Type:       job.Type,
+		Config:     json.RawMessage("null"),
+		SourcePath: job.SourcePath,
+		OutputDir:  dir,
+	}
+	if job.Source != nil {
+		req.SourceFilename = job.Source.Filename
+	}
+	if job.Task.Config != nil {
+		if err := job.Task.DecodeConfig(&req.Config); err != nil {
+			return nil, err
+		}
+	}
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal exec request: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(input)
+	stderr := &tailBuffer{size: stderrTailSize}
+	cmd.Stderr = stderr
+	cmd.WaitDelay = defaultKillDelay
+	setProcessGroup(cmd)
+	if h.Sandbox != nil {
+		if err := h.Sandbox.configure(cmd); err != nil {
+			return nil, err
+		}
+	}
+	// Standard output is copied by exec rather than read from a StdoutPipe so that WaitDelay
+	// bounds how long a process holding it open can delay Wait.
+	stdout, stdoutWriter := io.Pipe()
+	defer stdout.Close()
+	cmd.Stdout = stdoutWriter
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", h.Command, err)
+	}
+
+	var result *ExecMessage
+	var failure string
+	parsed := make(chan struct{})
+	go func() {
+		defer close(parsed)
+		readMessages(stdout, func(msg ExecMessage) {
+			switch msg.Type {
+			case "progress":
+				if job.Progress != nil {
+					job.Progress.Report(msg.Percent, msg.Message)
+				}
+			case "result":
+				result = &msg
+			case "error":
+				failure = msg.Message
+			}
+		})
+	}()
+	waitErr := cmd.Wait()
+	stdoutWriter.Close()
+	<-parsed
+	if errors.Is(waitErr, exec.ErrWaitDelay) {
+		// The command exited successfully but left a process holding its output open.
+		waitErr = nil
+	}
+
+	if ctx.Err() != nil {
+		return nil, context.Cause(ctx)
+	}
+	if waitErr != nil || failure != "" {
+		execErr := &ExecError{Message: failure, Err: waitErr, Stderr: stderr.String()}
+		if h.Sandbox != nil {
+			if limitErr := h.Sandbox.limitHit(execErr); limitErr != nil {
+				return nil, limitErr
+			}
+		}
+		return nil, execErr
+	}
+	if result == nil {
+		return nil, &ExecError{Message: "no result reported", Stderr: stderr.String()}
+	}
+
+	outputs := make([]Output, 0, 1+len(result.Attachments))
+	for i, name := range append([]string{result.Path}, result.Attachments...) {
+		path, err := outputPath(dir, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid result of %s: %w", h.Command, err)
+		}
+		filename := filepath.Base(name)
+		if i == 0 && result.Filename != "" {
+			filename = result.Filename
+		}
+		// The sandbox directory is removed on return: its outputs are kept in the job directory.
+		if dir != job.Dir {
+			kept := filepath.Join(job.Dir, fmt.Sprintf("output-%d%s", i, filepath.Ext(path)))
+			if err := moveFile(path, kept); err != nil {
+				return nil, err
+			}
+			path = kept
+		}
+		outputs = append(outputs, Output{Filename: filename, Path: path})
+	}
+	return newResult(outputs, result.Metadata), nil
+}
+
+// outputPath resolves a path reported by an external handler, which must name a regular file
+// inside its output directory dir once symbolic links are followed.
+func outputPath(dir, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("output %q is not a relative path", name)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, name))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("output %q is outside of the output directory", name)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("output %q is not a regular file", name)
+	}
+	return path, nil
+}
+
+// readMessages decodes the messages written on the standard output of an external handler, one JSON
+// object per line. Other lines are ignored, including those longer than maxMessageSize: r is always
+// read until EOF so that the handler never blocks writing its output.
+func readMessages(r io.Reader, handle func(ExecMessage)) {
+	reader := bufio.NewReaderSize(r, 64<<10)
+	var line []byte
+	oversized := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !oversized {
+			if len(line)+len(chunk) > maxMessageSize {
+				oversized = true
+				line = line[:0]
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		var msg ExecMessage
+		if !oversized && json.Unmarshal(line, &msg) == nil {
+			handle(msg)
+		}
+		line = line[:0]
+		oversized = false
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ExecError is returned when an external handler fails.
+type ExecError struct {
+	Message string // Reported by the command with an "error" message
+	Err     error  // Exit status of the command
+	Stderr  string // Tail of the standard error of the command
+}
+
+func (e *ExecError) Error() string {
+	var b strings.Builder
+	b.WriteString("external handler failed")
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		b.WriteString("\n" + stderr)
+	}
+	return b.String()
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code of the command, or -1 if it did not exit normally.
+func (e *ExecError) ExitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(e.Err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// tailBuffer keeps the last size bytes written to it.
+type tailBuffer struct {
+	mu   sync.Mutex
+	size int
+	buf  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.size; over > 0 {
+		b.buf = b.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package worker
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Resource limit signals do not exist on this platform.
+const (
+	sigCPU      syscall.Signal = -1
+	sigFileSize syscall.Signal = -2
+)
+
+// setProcessGroup is not supported on this platform: only the command itself is killed on cancellation.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// exitSignal always returns 0 on this platform.
+func exitSignal(err error) syscall.Signal {
+	return 0
+}
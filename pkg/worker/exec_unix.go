@@ -0,0 +1,36 @@
+//go:build unix
+
+package worker
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Signals sent by the kernel when the CPU time and file size limits are exceeded.
+const (
+	sigCPU      = syscall.SIGXCPU
+	sigFileSize = syscall.SIGXFSZ
+)
+
+// setProcessGroup starts the command in its own process group and kills the whole group on cancellation,
+// so that the children spawned by a script do not outlive it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// exitSignal returns the signal that terminated a command, or 0.
+func exitSignal(err error) syscall.Signal {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return status.Signal()
+	}
+	return 0
+}
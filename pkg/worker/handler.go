@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// Handler processes the tasks of one WorkerType.
+type Handler interface {
+	Handle(ctx context.Context, job *Job) (*Result, error)
+}
+
+// Job describes a claimed task handed to a Handler.
+type Job struct {
+	Task       models.Task
+	Type       models.WorkerType
+	Source     *models.File // Metadata of the source file
+	SourcePath string       // Local copy of the source file
+	Dir        string       // Scratch directory owned by the job, removed once the task is processed
+	Progress   ProgressReporter
+}
+
+// Result is the output produced by a Handler, uploaded as the task result.
+// The primary output is held in Data or, when Path is set, in the file at Path, which is streamed
+// instead of being loaded in memory; it may be written in Job.Dir.
+type Result struct {
+	Filename string
+	Data     []byte
+	Path     string
+
+	Attachments []Output               // Additional outputs, such as thumbnails or segment archives
+	Metadata    *models.ResultMetadata // Optional description of the primary output
+}
+
+// Output is an additional output of a Result, held in Data or in the file at Path.
+type Output struct {
+	Filename string
+	Data     []byte
+	Path     string
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
+)
+
+// heartbeat builds the status report of the worker for an instance, listing the tasks claimed from it.
+func (r *Runner) heartbeat(inst *instance, status models.WorkerStatus) models.HeartbeatRequest {
+	req := models.HeartbeatRequest{
+		Status:  status,
+		TaskIDs: []string{},
+		Load:    r.slots.load(),
+		Version: r.version,
+
+		Capabilities: r.Capabilities(),
+	}
+	for _, t := range r.running() {
+		if t.inst == inst {
+			req.TaskIDs = append(req.TaskIDs, t.task.ID)
+		}
+	}
+	slices.Sort(req.TaskIDs)
+	if status == models.WorkerStatusOnline && len(req.TaskIDs) > 0 {
+		req.Status = models.WorkerStatusBusy
+	}
+	if r.heartbeatPayload != nil {
+		r.heartbeatPayload(&req)
+	}
+	return req
+}
+
+// sendHeartbeat reports the status of the worker to every instance.
+func (r *Runner) sendHeartbeat(ctx context.Context, status models.WorkerStatus) {
+	for _, inst := range r.instances {
+		r.sendInstanceHeartbeat(ctx, inst, status)
+	}
+}
+
+func (r *Runner) sendInstanceHeartbeat(ctx context.Context, inst *instance, status models.WorkerStatus) {
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+	workers, ok := inst.Client.Workers.(services.HeartbeatService)
+	if !ok {
+		return
+	}
+	if err := workers.Heartbeat(ctx, r.heartbeat(inst, status)); err != nil {
+		r.logger.Error("failed to send heartbeat", "instance", inst.Name, "status", status, "error", err)
+	}
+}
+
+// startHeartbeat reports the worker status every heartbeat interval until the returned function is called,
+// which then marks the worker offline.
+func (r *Runner) startHeartbeat(ctx context.Context) (stop func()) {
+	if r.heartbeatInterval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(r.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			// An in-flight heartbeat is not cancelled so that it cannot reach the API after the offline one.
+			r.sendHeartbeat(context.WithoutCancel(ctx), models.WorkerStatusOnline)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		r.sendHeartbeat(context.Background(), models.WorkerStatusOffline)
+	}
+}
@@ -0,0 +1,201 @@
+// Package imagehandler provides a worker.Handler converting images with the standard library.
+// It fulfils models.ImageConversionConfig for JPEG and PNG outputs; GIF sources are also accepted.
+package imagehandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// Registers the GIF decoder for image.Decode.
+	_ "image/gif"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// ErrUnsupportedFormat is returned for output formats the standard library cannot encode, such as WebP.
+var ErrUnsupportedFormat = errors.New("imagehandler: unsupported output format")
+
+// DefaultMaxPixels is the size limit of decoded images when MaxPixels is zero, about 200 MB of RGBA pixels.
+const DefaultMaxPixels = 50_000_000
+
+// Handler converts images according to the models.ImageConversionConfig of their task.
+// Images are resized to Width and Height; when only one of them is set, the aspect ratio is kept.
+// Without a Format, JPEG sources stay JPEG and the other formats are encoded as PNG.
+type Handler struct {
+	// MaxPixels bounds the size of decoded and resized images to protect the worker memory against
+	// decompression bombs and oversized targets; zero is DefaultMaxPixels and a negative value is unlimited.
+	MaxPixels int
+}
+
+// New creates a Handler.
+func New() *Handler {
+	return &Handler{}
+}
+
+// ValidateConfig implements worker.ConfigValidator.
+func (h *Handler) ValidateConfig(task *models.Task) error {
+	config, err := decodeConfig(task)
+	if err != nil {
+		return err
+	}
+	switch config.Format {
+	case "", "jpeg", "png":
+	default:
+		return fmt.Errorf("%w %q", ErrUnsupportedFormat, config.Format)
+	}
+	// A single dimension is checked as if the other one was 1, the source being unknown yet.
+	return h.checkSize("target image", max(config.Width, 1), max(config.Height, 1))
+}
+
+// Handle implements worker.Handler.
+func (h *Handler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	config, err := decodeConfig(&job.Task)
+	if err != nil {
+		return nil, err
+	}
+
+	src, format, width, height, err := h.decode(job.SourcePath, config)
+	if err != nil {
+		return nil, err
+	}
+	report(job, 25, "decoded")
+
+	if width != src.Bounds().Dx() || height != src.Bounds().Dy() {
+		if src, err = resize(ctx, src, width, height); err != nil {
+			return nil, err
+		}
+	}
+	report(job, 75, "resized")
+
+	output := config.Format
+	if output == "" {
+		output = "png"
+		if format == "jpeg" {
+			output = "jpeg"
+		}
+	}
+	var buf bytes.Buffer
+	switch output {
+	case "jpeg":
+		quality := config.Quality
+		if quality == 0 {
+			quality = jpeg.DefaultQuality
+		}
+		err = jpeg.Encode(&buf, src, &jpeg.Options{Quality: quality})
+	case "png":
+		err = png.Encode(&buf, src)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedFormat, output)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s image: %w", output, err)
+	}
+	report(job, 100, "encoded")
+
+	return &worker.Result{Filename: outputName(job, output), Data: buf.Bytes()}, nil
+}
+
+// decode reads the source image and computes its target size, checking the dimensions of both
+// before decoding the pixels.
+func (h *Handler) decode(path string, config *models.ImageConversionConfig) (img image.Image, format string, width, height int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("failed to read source image: %w", err)
+	}
+	if err := h.checkSize("source image", cfg.Width, cfg.Height); err != nil {
+		return nil, "", 0, 0, err
+	}
+	width, height, err = targetSize(image.Rect(0, 0, cfg.Width, cfg.Height), config.Width, config.Height)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	if err := h.checkSize("target image", width, height); err != nil {
+		return nil, "", 0, 0, err
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, "", 0, 0, err
+	}
+	img, _, err = image.Decode(f)
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("failed to decode %s source image: %w", format, err)
+	}
+	return img, format, width, height, nil
+}
+
+// checkSize rejects images of more than MaxPixels pixels.
+func (h *Handler) checkSize(kind string, width, height int) error {
+	limit := h.MaxPixels
+	if limit == 0 {
+		limit = DefaultMaxPixels
+	}
+	// Dividing rather than multiplying keeps large configured dimensions from overflowing.
+	if limit > 0 && width > 0 && height > 0 && width > limit/height {
+		return fmt.Errorf("%s of %dx%d pixels exceeds the limit of %d pixels", kind, width, height, limit)
+	}
+	return nil
+}
+
+func decodeConfig(task *models.Task) (*models.ImageConversionConfig, error) {
+	config := models.NewImageConfig()
+	if err := task.DecodeConfig(config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// targetSize computes the output dimensions, keeping the aspect ratio when only one is set.
+// Empty images, which have no aspect ratio, are rejected.
+func targetSize(bounds image.Rectangle, width, height int) (int, int, error) {
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("source image of %dx%d pixels is empty", w, h)
+	}
+	switch {
+	case width > 0 && height > 0:
+		return width, height, nil
+	case width > 0:
+		return width, max(1, h*width/w), nil
+	case height > 0:
+		return max(1, w*height/h), height, nil
+	default:
+		return w, h, nil
+	}
+}
+
+// outputName replaces the extension of the source filename with the one of the output format.
+func outputName(job *worker.Job, format string) string {
+	name := "image"
+	if job.Source != nil && job.Source.Filename != "" {
+		name = filepath.Base(job.Source.Filename)
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	ext := ".png"
+	if format == "jpeg" {
+		ext = ".jpg"
+	}
+	return name + ext
+}
+
+func report(job *worker.Job, percent float64, message string) {
+	if job.Progress != nil {
+		job.Progress.Report(percent, message)
+	}
+}
@@ -0,0 +1,94 @@
+package imagehandler
+
+import (
+	"context"
+	"image"
+	"image/draw"
+)
+
+// resize scales src to width x height. Each output pixel averages the source pixels it covers,
+// which avoids the aliasing of nearest-neighbour sampling when shrinking, and falls back to
+// bilinear interpolation when enlarging. It stops early if ctx is done.
+func resize(ctx context.Context, src image.Image, width, height int) (image.Image, error) {
+	in := toRGBA(src)
+	sw, sh := in.Rect.Dx(), in.Rect.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(sw) / float64(width)
+	scaleY := float64(sh) / float64(height)
+
+	for y := 0; y < height; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, context.Cause(ctx)
+		}
+		y0, y1 := span(y, scaleY, sh)
+		for x := 0; x < width; x++ {
+			x0, x1 := span(x, scaleX, sw)
+			var px [4]float64
+			if x1-x0 <= 1 && y1-y0 <= 1 {
+				px = bilinear(in, (float64(x)+0.5)*scaleX-0.5, (float64(y)+0.5)*scaleY-0.5)
+			} else {
+				px = average(in, x0, y0, x1, y1)
+			}
+			i := out.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				out.Pix[i+c] = uint8(min(max(px[c]+0.5, 0), 255))
+			}
+		}
+	}
+	return out, nil
+}
+
+// span returns the source pixels covered by the output pixel i.
+func span(i int, scale float64, size int) (int, int) {
+	start := int(float64(i) * scale)
+	end := max(int(float64(i+1)*scale), start+1)
+	return min(start, size-1), min(end, size)
+}
+
+// average returns the mean of the pixels of the rectangle [x0,x1) x [y0,y1).
+func average(img *image.RGBA, x0, y0, x1, y1 int) [4]float64 {
+	var sum [4]float64
+	for y := y0; y < y1; y++ {
+		i := img.PixOffset(x0, y)
+		for x := x0; x < x1; x++ {
+			for c := 0; c < 4; c++ {
+				sum[c] += float64(img.Pix[i+c])
+			}
+			i += 4
+		}
+	}
+	n := float64((x1 - x0) * (y1 - y0))
+	for c := range sum {
+		sum[c] /= n
+	}
+	return sum
+}
+
+// bilinear interpolates the pixel at the fractional position (fx, fy).
+func bilinear(img *image.RGBA, fx, fy float64) [4]float64 {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	fx = min(max(fx, 0), float64(w-1))
+	fy = min(max(fy, 0), float64(h-1))
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+	dx, dy := fx-float64(x0), fy-float64(y0)
+
+	var px [4]float64
+	for c := 0; c < 4; c++ {
+		top := float64(img.Pix[img.PixOffset(x0, y0)+c])*(1-dx) + float64(img.Pix[img.PixOffset(x1, y0)+c])*dx
+		bottom := float64(img.Pix[img.PixOffset(x0, y1)+c])*(1-dx) + float64(img.Pix[img.PixOffset(x1, y1)+c])*dx
+		px[c] = top*(1-dy) + bottom*dy
+	}
+	return px
+}
+
+// toRGBA returns src as an *image.RGBA whose bounds start at the origin.
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, src, b.Min, draw.Src)
+	return rgba
+}
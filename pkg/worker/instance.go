@@ -0,0 +1,249 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
+)
+
+// DefaultInstance is the name of the instance reached through the client given to NewRunner.
+const DefaultInstance = "default"
+
+// instanceName restricts instance names to what can be used as a directory name.
+var instanceName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// Policy decides in which order a Runner serving several instances polls them.
+// Whatever the policy, a poll tries every instance until one of them has a pending task.
+type Policy int
+
+const (
+	// PolicyPriority polls the instances by decreasing priority: an instance only gets tasks
+	// claimed when those of higher priority have none pending.
+	PolicyPriority Policy = iota
+	// PolicyRoundRobin starts every poll with the instance following the one started with last time.
+	PolicyRoundRobin
+	// PolicyWeighted starts polls with each instance in proportion to its weight.
+	PolicyWeighted
+)
+
+// Instance is a Qalpuch API served by a Runner in addition to the one of its client, see WithInstance.
+// Each instance keeps its own credentials and metrics; the tasks claimed from an instance are
+// reported to it alone.
+type Instance struct {
+	Name              string // Identifies the instance in logs, metrics and the journal
+	Client            *clients.Client
+	RegistrationToken string // See WithRegistrationToken
+	RefreshToken      string // See WithRefreshToken
+	CredentialsFile   string // See WithCredentialsFile
+	Priority          int    // Instances of higher priority are polled first with PolicyPriority
+	Weight            int    // Share of the polls started with the instance with PolicyWeighted; zero counts as one
+}
+
+// instance is the state of an API served by the Runner.
+type instance struct {
+	Instance
+	metrics *metrics
+	ready   atomic.Bool // The last poll of the instance succeeded
+	noLease atomic.Bool // The API does not support lease renewal
+	current int         // Smooth weighted round-robin counter
+}
+
+func newInstance(cfg Instance) *instance {
+	return &instance{Instance: cfg, metrics: newMetrics()}
+}
+
+// isReady reports whether the worker holds a token for the instance and its last poll succeeded.
+func (inst *instance) isReady() bool {
+	return inst.Client.GetToken() != "" && inst.ready.Load()
+}
+
+func (inst *instance) weight() int {
+	return max(inst.Weight, 1)
+}
+
+// validateInstances checks that the instances can be told apart.
+func (r *Runner) validateInstances() error {
+	if len(r.instances) == 0 {
+		return errors.New("worker: no client configured")
+	}
+	names := make(map[string]bool)
+	for _, inst := range r.instances {
+		switch {
+		case inst.Client == nil:
+			return fmt.Errorf("worker: instance %q has no client", inst.Name)
+		case !instanceName.MatchString(inst.Name):
+			return fmt.Errorf("worker: invalid instance name %q", inst.Name)
+		case names[inst.Name]:
+			return fmt.Errorf("worker: duplicate instance name %q", inst.Name)
+		case inst.Weight < 0:
+			return fmt.Errorf("worker: negative weight for instance %q", inst.Name)
+		}
+		names[inst.Name] = true
+	}
+	return nil
+}
+
+// instance returns the instance of the given name, or nil.
+func (r *Runner) instance(name string) *instance {
+	for _, inst := range r.instances {
+		if inst.Name == name {
+			return inst
+		}
+	}
+	return nil
+}
+
+// order returns the instances in the order of the next poll, according to the policy.
+// It is only called by the polling loop.
+func (r *Runner) order() []*instance {
+	if len(r.instances) == 1 {
+		return r.instances
+	}
+	switch r.policy {
+	case PolicyRoundRobin:
+		start := r.nextInstance % len(r.instances)
+		r.nextInstance++
+		return append(slices.Clone(r.instances[start:]), r.instances[:start]...)
+	case PolicyWeighted:
+		// Smooth weighted round-robin spreads the instances evenly; the others follow in their configuration order.
+		var first *instance
+		total := 0
+		for _, inst := range r.instances {
+			inst.current += inst.weight()
+			total += inst.weight()
+			if first == nil || inst.current > first.current {
+				first = inst
+			}
+		}
+		first.current -= total
+		order := []*instance{first}
+		for _, inst := range r.instances {
+			if inst != first {
+				order = append(order, inst)
+			}
+		}
+		return order
+	default:
+		order := slices.Clone(r.instances)
+		slices.SortStableFunc(order, func(a, b *instance) int { return cmp.Compare(b.Priority, a.Priority) })
+		return order
+	}
+}
+
+// pendingTask claims a pending task, without the options when the task service of the instance
+// does not support them.
+func (inst *instance) pendingTask(ctx context.Context, opts models.PendingTaskOptions) (*models.Task, error) {
+	if tasks, ok := inst.Client.Tasks.(services.TaskWorkerService); ok {
+		return tasks.GetPendingTaskWithOptions(ctx, opts)
+	}
+	return inst.Client.Tasks.GetPendingTask(ctx)
+}
+
+// uploadResult uploads the outputs of a task. A task service without UploadTaskResults only
+// receives the primary output.
+func (inst *instance) uploadResult(ctx context.Context, id string, result *Result) error {
+	if tasks, ok := inst.Client.Tasks.(services.TaskWorkerService); ok {
+		_, err := tasks.UploadTaskResults(ctx, id, result.uploadRequest())
+		return err
+	}
+	data := result.Data
+	if result.Path != "" {
+		var err error
+		if data, err = os.ReadFile(result.Path); err != nil {
+			return fmt.Errorf("failed to read result: %w", err)
+		}
+	}
+	return inst.Client.Tasks.UploadTaskResult(ctx, id, result.Filename, data)
+}
+
+// poll claims the next pending task among the given types, trying the instances in the order of
+// the policy. It returns sdkerrors.ErrNoPendingTask when no instance has a task, including when
+// some of them could not be reached.
+func (r *Runner) poll(ctx context.Context, types []models.WorkerType) (*models.Task, *instance, error) {
+	// A long poll would keep the other instances waiting.
+	wait := r.longPoll
+	if len(r.instances) > 1 {
+		wait = 0
+	}
+	opts := models.PendingTaskOptions{Wait: wait}
+	if r.typeFilter {
+		opts.Types = types
+	}
+	for _, inst := range r.order() {
+		started := time.Now()
+		task, err := inst.pendingTask(ctx, opts)
+		r.metrics.observePoll(time.Since(started))
+		inst.metrics.observePoll(time.Since(started))
+		inst.ready.Store(err == nil || errors.Is(err, sdkerrors.ErrNoPendingTask))
+		switch {
+		case err == nil:
+			return task, inst, nil
+		case ctx.Err() != nil:
+			return nil, nil, ctx.Err()
+		case errors.Is(err, sdkerrors.ErrNoPendingTask):
+			// The queue of this instance is empty.
+		case errors.Is(err, sdkerrors.ErrUnauthorized) && inst.RefreshToken != "":
+			if err := r.refresh(ctx, inst); err != nil {
+				r.logger.Error("failed to refresh worker token", "instance", inst.Name, "error", err)
+			}
+		default:
+			r.logger.Error("failed to poll pending task", "instance", inst.Name, "error", err)
+		}
+	}
+	return nil, nil, sdkerrors.ErrNoPendingTask
+}
+
+// authenticate enrolls the worker with an instance when a credentials file is configured, and
+// otherwise exchanges the registration token for a JWT when the client has none.
+func (r *Runner) authenticate(ctx context.Context, inst *instance) error {
+	if inst.CredentialsFile != "" {
+		creds, err := Enroll(ctx, inst.Client, inst.CredentialsFile, inst.RegistrationToken)
+		if err != nil {
+			return err
+		}
+		inst.RefreshToken = creds.RefreshToken
+		return nil
+	}
+	if inst.Client.GetToken() != "" || inst.RegistrationToken == "" {
+		return nil
+	}
+	resp, err := inst.Client.Workers.RegisterWorker(ctx, inst.RegistrationToken)
+	if err != nil {
+		return fmt.Errorf("worker: failed to register with instance %q: %w", inst.Name, err)
+	}
+	inst.Client.SetToken(resp.Data.Token)
+	if resp.Data.RefreshToken != "" {
+		inst.RefreshToken = resp.Data.RefreshToken
+	}
+	return nil
+}
+
+// refresh renews the JWT of an instance with its refresh token.
+func (r *Runner) refresh(ctx context.Context, inst *instance) error {
+	resp, err := inst.Client.Workers.RefreshAuth(ctx, inst.RefreshToken)
+	if err != nil {
+		return err
+	}
+	inst.Client.SetToken(resp.Data.Token)
+	if resp.Data.RefreshToken != "" {
+		inst.RefreshToken = resp.Data.RefreshToken
+	}
+	if inst.CredentialsFile != "" {
+		creds := &Credentials{Token: resp.Data.Token, RefreshToken: inst.RefreshToken, UpdatedAt: time.Now().UTC()}
+		if err := SaveCredentials(inst.CredentialsFile, creds); err != nil {
+			r.logger.Error("failed to save renewed credentials", "instance", inst.Name, "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// Phase is the step reached by a claimed task, as recorded in the journal.
+type Phase string
+
+const (
+	PhaseDownloading Phase = "downloading"
+	PhaseProcessing  Phase = "processing"
+	PhaseUploading   Phase = "uploading"
+)
+
+const (
+	journalFile = "journal.json"
+	resultsDir  = "results"
+)
+
+// journalEntry records a claimed task.
+type journalEntry struct {
+	TaskID     string            `json:"taskId"`
+	Instance   string            `json:"instance"`
+	Type       models.WorkerType `json:"type"`
+	Phase      Phase             `json:"phase"`
+	ClaimedAt  time.Time         `json:"claimedAt"`
+	ResultPath string            `json:"resultPath,omitempty"`
+	ResultName string            `json:"resultName,omitempty"`
+
+	Attachments []savedOutput          `json:"attachments,omitempty"`
+	Metadata    *models.ResultMetadata `json:"metadata,omitempty"`
+}
+
+// savedOutput is an attachment of a result written next to the journal.
+type savedOutput struct {
+	Filename string `json:"filename"`
+	Path     string `json:"path"`
+}
+
+// journal persists the claimed tasks of a Runner so that their outcome can be reported after a crash.
+// Results are written next to it before being uploaded.
+type journal struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]*journalEntry
+}
+
+func newJournal(dir string) *journal {
+	return &journal{dir: dir, entries: make(map[string]*journalEntry)}
+}
+
+// load reads the entries left by a previous run.
+func (j *journal) load() ([]journalEntry, error) {
+	data, err := os.ReadFile(filepath.Join(j.dir, journalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("worker: failed to read journal: %w", err)
+	}
+	var entries []journalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("worker: failed to decode journal: %w", err)
+	}
+	return entries, nil
+}
+
+// record sets the phase of a task.
+func (j *journal) record(t *run, phase Phase) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entry(t).Phase = phase
+	return j.save()
+}
+
+// saveResult writes the outputs of a task to disk and records that it is being uploaded.
+// It returns the result read from the saved outputs.
+func (j *journal) saveResult(t *run, result *Result) (*Result, error) {
+	dir := filepath.Join(j.dir, resultsDir, t.inst.Name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create results directory: %w", err)
+	}
+	outputs := result.outputs()
+	saved := make([]Output, len(outputs))
+	for i, o := range outputs {
+		path := filepath.Join(dir, t.task.ID)
+		if i > 0 {
+			path = fmt.Sprintf("%s.%d", path, i)
+		}
+		if _, err := storeOutput(path, o); err != nil {
+			return nil, fmt.Errorf("failed to save result: %w", err)
+		}
+		saved[i] = Output{Filename: o.Filename, Path: path}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry := j.entry(t)
+	entry.Phase = PhaseUploading
+	entry.ResultPath = saved[0].Path
+	entry.ResultName = saved[0].Filename
+	entry.Attachments = nil
+	for _, o := range saved[1:] {
+		entry.Attachments = append(entry.Attachments, savedOutput{Filename: o.Filename, Path: o.Path})
+	}
+	entry.Metadata = result.Metadata
+	return newResult(saved, result.Metadata), j.save()
+}
+
+// remove clears the entry of a task, identified by run.key, and its saved result.
+func (j *journal) remove(key string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := j.entries[key]
+	if !ok {
+		return nil
+	}
+	delete(j.entries, key)
+	if err := entry.removeOutputs(); err != nil {
+		return err
+	}
+	return j.save()
+}
+
+// result returns the result saved for the entry.
+func (e *journalEntry) result() *Result {
+	outputs := []Output{{Filename: e.ResultName, Path: e.ResultPath}}
+	for _, o := range e.Attachments {
+		outputs = append(outputs, Output{Filename: o.Filename, Path: o.Path})
+	}
+	return newResult(outputs, e.Metadata)
+}
+
+// removeOutputs removes the saved outputs of the entry.
+func (e *journalEntry) removeOutputs() error {
+	paths := []string{e.ResultPath}
+	for _, o := range e.Attachments {
+		paths = append(paths, o.Path)
+	}
+	var errs []error
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if e.ResultPath != "" {
+		// The directory of the instance is only removed once it holds no other result.
+		_ = os.Remove(filepath.Dir(e.ResultPath))
+	}
+	return errors.Join(errs...)
+}
+
+// entry returns the entry of a task, creating it if needed; j.mu must be held.
+func (j *journal) entry(t *run) *journalEntry {
+	entry, ok := j.entries[t.key()]
+	if !ok {
+		entry = &journalEntry{TaskID: t.task.ID, Instance: t.inst.Name, Type: t.workerType, ClaimedAt: t.started}
+		j.entries[t.key()] = entry
+	}
+	return entry
+}
+
+// save writes the journal; j.mu must be held.
+func (j *journal) save() error {
+	entries := make([]*journalEntry, 0, len(j.entries))
+	for _, entry := range j.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(j.dir, 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(j.dir, journalFile), data, 0o600)
+}
+
+// writeFileAtomic replaces the file at path with data, so that readers never see a partial file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeAtomic(path, bytes.NewReader(data), perm)
+}
+
+// writeAtomic replaces the file at path with the content of r, so that readers never see a partial file.
+func writeAtomic(path string, r io.Reader, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// recoverJournal reports the outcome of the tasks claimed before the previous run stopped:
+// results that were being uploaded are uploaded again, the other tasks are reported as failed.
+func (r *Runner) recoverJournal(ctx context.Context) error {
+	entries, err := r.journal.load()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		logger := r.logger.With("task", entry.TaskID, "instance", entry.Instance, "phase", entry.Phase)
+		inst := r.instance(entry.Instance)
+		switch {
+		case inst == nil:
+			logger.Warn("dropping task interrupted by a restart: its instance is no longer served")
+		case entry.Phase == PhaseUploading:
+			err := inst.uploadResult(ctx, entry.TaskID, entry.result())
+			switch {
+			case err == nil:
+				logger.Info("uploaded result of a task interrupted by a restart")
+			case errors.Is(err, sdkerrors.ErrLeaseLost):
+				logger.Warn("task interrupted by a restart now belongs to another worker")
+			default:
+				r.report(ctx, inst, entry.TaskID, models.TaskStatusFailed, truncate(fmt.Sprintf("worker restarted: failed to upload result: %v", err), maxStatusMessageLength))
+			}
+		default:
+			logger.Warn("reporting task interrupted by a restart as failed")
+			r.report(ctx, inst, entry.TaskID, models.TaskStatusFailed, "worker restarted")
+		}
+		if err := entry.removeOutputs(); err != nil {
+			logger.Warn("failed to remove saved result", "error", err)
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	r.journal.mu.Lock()
+	defer r.journal.mu.Unlock()
+	return r.journal.save()
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
+)
+
+// renewLease renews the lease of a task every renewal interval until ctx is done.
+// Renewal stops for good on an instance whose API does not support it, which rejects the
+// renewal as not found or as a bad request.
+func (r *Runner) renewLease(ctx context.Context, t *run) {
+	tasks, ok := t.inst.Client.Tasks.(services.TaskWorkerService)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(r.leaseRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if t.inst.noLease.Load() {
+			return
+		}
+
+		_, err := tasks.RenewTaskLease(ctx, t.task.ID)
+		switch {
+		case errors.Is(err, sdkerrors.ErrLeaseLost):
+			r.loseLease(t)
+			return
+		case errors.Is(err, sdkerrors.ErrNotFound) || errors.Is(err, sdkerrors.ErrBadRequest):
+			if !t.inst.noLease.Swap(true) {
+				r.logger.Warn("lease renewal is not supported by the API, disabling it", "instance", t.inst.Name, "error", err)
+			}
+			return
+		case err != nil && ctx.Err() == nil:
+			r.logger.Error("failed to renew task lease", "task", t.task.ID, "instance", t.inst.Name, "error", err)
+		}
+	}
+}
+
+// loseLease abandons a task that is now owned by another worker: its handler is cancelled
+// with sdkerrors.ErrLeaseLost as cause and no further status is reported for it.
+func (r *Runner) loseLease(t *run) {
+	if t.settle() {
+		r.logger.Warn("task lease lost, abandoning task", "task", t.task.ID)
+	}
+	t.cancel(sdkerrors.ErrLeaseLost)
+}
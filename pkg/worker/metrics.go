@@ -0,0 +1,244 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the duration histograms.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// histogram accumulates observations into cumulative buckets.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// metrics are the counters of a Runner, exposed in the Prometheus text format.
+type metrics struct {
+	mu        sync.Mutex
+	claimed   map[models.WorkerType]uint64
+	succeeded map[models.WorkerType]uint64
+	failed    map[models.WorkerType]uint64
+	dead      map[models.WorkerType]uint64
+	handler   map[models.WorkerType]*histogram
+	poll      histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		claimed:   make(map[models.WorkerType]uint64),
+		succeeded: make(map[models.WorkerType]uint64),
+		failed:    make(map[models.WorkerType]uint64),
+		dead:      make(map[models.WorkerType]uint64),
+		handler:   make(map[models.WorkerType]*histogram),
+	}
+}
+
+// taskCounter identifies one of the task counters of metrics.
+type taskCounter int
+
+const (
+	claimedTasks taskCounter = iota
+	succeededTasks
+	failedTasks
+	deadLetteredTasks
+)
+
+func (m *metrics) count(c taskCounter, workerType models.WorkerType) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch c {
+	case claimedTasks:
+		m.claimed[workerType]++
+	case succeededTasks:
+		m.succeeded[workerType]++
+	case failedTasks:
+		m.failed[workerType]++
+	case deadLetteredTasks:
+		m.dead[workerType]++
+	}
+}
+
+// count increments a task counter of the Runner and of the instance the task was claimed from.
+func (r *Runner) count(t *run, c taskCounter) {
+	r.metrics.count(c, t.workerType)
+	t.inst.metrics.count(c, t.workerType)
+}
+
+func (m *metrics) observeHandler(workerType models.WorkerType, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.handler[workerType]
+	if !ok {
+		h = &histogram{}
+		m.handler[workerType] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func (m *metrics) observePoll(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.poll.observe(d.Seconds())
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+func (m *metrics) write(w io.Writer, running int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounter(w, "qalpuch_worker_tasks_claimed_total", "Tasks claimed by the worker.", m.claimed)
+	writeCounter(w, "qalpuch_worker_tasks_succeeded_total", "Tasks whose result has been uploaded.", m.succeeded)
+	writeCounter(w, "qalpuch_worker_tasks_failed_total", "Tasks reported as failed.", m.failed)
+	writeCounter(w, "qalpuch_worker_tasks_dead_lettered_total", "Failed tasks dead-lettered with a diagnostic bundle.", m.dead)
+
+	fmt.Fprintln(w, "# HELP qalpuch_worker_handler_duration_seconds Time spent in task handlers.")
+	fmt.Fprintln(w, "# TYPE qalpuch_worker_handler_duration_seconds histogram")
+	for _, workerType := range slices.Sorted(maps.Keys(m.handler)) {
+		writeHistogram(w, "qalpuch_worker_handler_duration_seconds", fmt.Sprintf("type=%q,", workerType), m.handler[workerType])
+	}
+
+	fmt.Fprintln(w, "# HELP qalpuch_worker_poll_duration_seconds Time spent claiming tasks, including long polling.")
+	fmt.Fprintln(w, "# TYPE qalpuch_worker_poll_duration_seconds histogram")
+	writeHistogram(w, "qalpuch_worker_poll_duration_seconds", "", &m.poll)
+
+	fmt.Fprintln(w, "# HELP qalpuch_worker_running_tasks Tasks being processed.")
+	fmt.Fprintln(w, "# TYPE qalpuch_worker_running_tasks gauge")
+	fmt.Fprintf(w, "qalpuch_worker_running_tasks %d\n", running)
+}
+
+// writeInstances renders the metrics of each instance, labelled with its name.
+func writeInstances(w io.Writer, instances []*instance) {
+	series := []struct {
+		name, help string
+		values     func(m *metrics) map[models.WorkerType]uint64
+	}{
+		{"qalpuch_worker_instance_tasks_claimed_total", "Tasks claimed from the instance.", func(m *metrics) map[models.WorkerType]uint64 { return m.claimed }},
+		{"qalpuch_worker_instance_tasks_succeeded_total", "Tasks whose result has been uploaded to the instance.", func(m *metrics) map[models.WorkerType]uint64 { return m.succeeded }},
+		{"qalpuch_worker_instance_tasks_failed_total", "Tasks reported to the instance as failed.", func(m *metrics) map[models.WorkerType]uint64 { return m.failed }},
+	}
+	for _, s := range series {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", s.name, s.help, s.name)
+		for _, inst := range instances {
+			inst.metrics.mu.Lock()
+			values := s.values(inst.metrics)
+			for _, workerType := range slices.Sorted(maps.Keys(values)) {
+				fmt.Fprintf(w, "%s{instance=%q,type=%q} %d\n", s.name, inst.Name, workerType, values[workerType])
+			}
+			inst.metrics.mu.Unlock()
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP qalpuch_worker_instance_poll_duration_seconds Time spent claiming tasks from the instance.")
+	fmt.Fprintln(w, "# TYPE qalpuch_worker_instance_poll_duration_seconds histogram")
+	for _, inst := range instances {
+		inst.metrics.mu.Lock()
+		writeHistogram(w, "qalpuch_worker_instance_poll_duration_seconds", fmt.Sprintf("instance=%q,", inst.Name), &inst.metrics.poll)
+		inst.metrics.mu.Unlock()
+	}
+
+	fmt.Fprintln(w, "# HELP qalpuch_worker_instance_ready Whether the worker holds a token for the instance and its last poll succeeded.")
+	fmt.Fprintln(w, "# TYPE qalpuch_worker_instance_ready gauge")
+	for _, inst := range instances {
+		ready := 0
+		if inst.isReady() {
+			ready = 1
+		}
+		fmt.Fprintf(w, "qalpuch_worker_instance_ready{instance=%q} %d\n", inst.Name, ready)
+	}
+}
+
+func writeCounter(w io.Writer, name, help string, values map[models.WorkerType]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, workerType := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(w, "%s{type=%q} %d\n", name, workerType, values[workerType])
+	}
+}
+
+// writeHistogram writes the series of h; labels, if any, end with a comma.
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	for i, bound := range durationBuckets {
+		var n uint64
+		if h.counts != nil {
+			n = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, strconv.FormatFloat(bound, 'g', -1, 64), n)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, labels, h.count)
+	if labels != "" {
+		labels = "{" + labels[:len(labels)-1] + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// MetricsHandler serves the health and metrics endpoints of the Runner:
+// /healthz answers as long as the process runs, /readyz once the worker holds a token
+// for one of its instances and its last call to it succeeded, and /metrics in the Prometheus text format.
+func (r *Runner) MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, req *http.Request) {
+		if !slices.ContainsFunc(r.instances, (*instance).isReady) {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.metrics.write(w, len(r.running()))
+		writeInstances(w, r.instances)
+	})
+	return mux
+}
+
+// serveMetrics starts the metrics server configured with WithMetricsAddr; stop shuts it down.
+func (r *Runner) serveMetrics() (stop func(), err error) {
+	if r.metricsAddr == "" {
+		return func() {}, nil
+	}
+	listener, err := net.Listen("tcp", r.metricsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("worker: failed to listen for metrics: %w", err)
+	}
+	server := &http.Server{Handler: r.MetricsHandler(), ReadHeaderTimeout: reportTimeout}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			r.logger.Error("metrics server failed", "error", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// HandlerFunc adapts an ordinary function to the Handler interface.
+type HandlerFunc func(ctx context.Context, job *Job) (*Result, error)
+
+// Handle calls f(ctx, job).
+func (f HandlerFunc) Handle(ctx context.Context, job *Job) (*Result, error) {
+	return f(ctx, job)
+}
+
+// Middleware wraps a Handler with cross-cutting behaviour.
+type Middleware func(Handler) Handler
+
+// Chain wraps h with the middlewares; the first one is the outermost.
+func Chain(h Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// Logging logs the start and the outcome of every job.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, job *Job) (*Result, error) {
+			started := time.Now()
+			logger.Info("task started", "task", job.Task.ID, "type", job.Type)
+			result, err := next.Handle(ctx, job)
+			if err != nil {
+				logger.Error("task failed", "task", job.Task.ID, "type", job.Type, "duration", time.Since(started), "error", err)
+				return nil, err
+			}
+			logger.Info("task completed", "task", job.Task.ID, "type", job.Type, "duration", time.Since(started))
+			return result, nil
+		})
+	}
+}
+
+// transientError marks an error worth retrying.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// Transient marks err as transient: the Retry middleware runs the handler again when it is returned.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &transientError{err: err}
+}
+
+// IsTransient reports whether err, or an error it wraps, has been marked with Transient.
+func IsTransient(err error) bool {
+	var t *transientError
+	return errors.As(err, &t)
+}
+
+// Retry runs the handler up to attempts times while it returns a transient error.
+// newBackoff creates the delays between attempts for each job; nil waits one second.
+func Retry(attempts int, newBackoff func() Backoff) Middleware {
+	if newBackoff == nil {
+		newBackoff = func() Backoff { return ConstantBackoff(time.Second) }
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, job *Job) (*Result, error) {
+			b := newBackoff()
+			for attempt := 1; ; attempt++ {
+				result, err := next.Handle(ctx, job)
+				if err == nil || !IsTransient(err) || attempt >= attempts {
+					return result, err
+				}
+				if !sleep(ctx, b.Next()) {
+					return nil, err
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package worker
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithHandler registers the handler used for tasks of the given type.
+func WithHandler(workerType models.WorkerType, h Handler) Option {
+	return func(r *Runner) {
+		r.handlers[workerType] = h
+	}
+}
+
+// WithMiddleware wraps every registered handler with the middlewares, the first one being the outermost.
+// It may be given several times; earlier middlewares wrap later ones.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(r *Runner) {
+		r.middlewares = append(r.middlewares, middlewares...)
+	}
+}
+
+// WithRegistrationToken sets the one-time token exchanged for a JWT when the client has no token yet.
+func WithRegistrationToken(token string) Option {
+	return func(r *Runner) {
+		r.registrationToken = token
+	}
+}
+
+// WithRefreshToken sets the refresh token used to renew the JWT when the API rejects it.
+func WithRefreshToken(token string) Option {
+	return func(r *Runner) {
+		r.refreshToken = token
+	}
+}
+
+// WithCredentialsFile persists the tokens of the worker at path, see Enroll.
+// On startup, stored credentials are reused, and refreshed when they hold a refresh token; the
+// registration token is only used when the file does not exist. Tokens renewed later are saved as well.
+func WithCredentialsFile(path string) Option {
+	return func(r *Runner) {
+		r.credentialsFile = path
+	}
+}
+
+// WithInstance adds an API instance served by the Runner besides the one of its client.
+// The registration token, refresh token and credentials file options only apply to the client
+// given to NewRunner; each instance carries its own.
+func WithInstance(cfg Instance) Option {
+	return func(r *Runner) {
+		r.instances = append(r.instances, newInstance(cfg))
+	}
+}
+
+// WithPolicy sets the order in which the instances are polled, PolicyPriority by default.
+func WithPolicy(p Policy) Option {
+	return func(r *Runner) {
+		r.policy = p
+	}
+}
+
+// WithPollInterval sets a constant delay between two polls when no task is pending.
+func WithPollInterval(d time.Duration) Option {
+	return WithIdleBackoff(ConstantBackoff(d))
+}
+
+// WithIdleBackoff sets the strategy computing the delay between two polls when no task is pending.
+func WithIdleBackoff(b Backoff) Option {
+	return func(r *Runner) {
+		r.backoff = b
+	}
+}
+
+// WithLongPoll asks the API to hold each poll for up to wait until a task is available.
+// Long polling is an extension of the documented API; polls fall back to the plain endpoint
+// when the API rejects it.
+func WithLongPoll(wait time.Duration) Option {
+	return func(r *Runner) {
+		r.longPoll = wait
+	}
+}
+
+// WithTypeFilter asks the API to only return tasks of the types with a free slot. The filter is an
+// extension of the documented API; polls fall back to the plain endpoint when the API rejects it,
+// and the tasks that do not fit are handed back, see WithTypeLimit.
+func WithTypeFilter() Option {
+	return func(r *Runner) {
+		r.typeFilter = true
+	}
+}
+
+// WithWorkDir sets the directory in which per-task scratch directories are created.
+// The directory belongs to the Runner, which also keeps there the journal of its claimed tasks
+// and removes the task directories left by a previous run at startup: workers must not share it.
+// The Runner locks the directory while it runs: a second worker using it fails to start.
+// It defaults to qalpuch-worker in the user cache directory, see os.UserCacheDir.
+func WithWorkDir(dir string) Option {
+	return func(r *Runner) {
+		r.workDir = dir
+	}
+}
+
+// WithDiskQuota bounds the disk space reserved by running tasks, in bytes.
+// Each task reserves twice the size of its source file; tasks that do not fit are handed back as
+// pending, whatever WithHandBackStatus, so that a worker with more space can claim them.
+func WithDiskQuota(bytes int64) Option {
+	return func(r *Runner) {
+		r.diskQuota = bytes
+	}
+}
+
+// WithMinFreeSpace sets the disk space, in bytes, that tasks must leave free in the work directory,
+// 64 MiB by default. No task is claimed while the disk has less free space.
+func WithMinFreeSpace(bytes int64) Option {
+	return func(r *Runner) {
+		r.minFreeSpace = bytes
+	}
+}
+
+// WithResultCache reuses the results of identical conversions, which have the same source file
+// hash and the same configuration. Results are stored in dir, the least recently used ones being
+// evicted once they exceed maxBytes; a cached result is uploaded without downloading the source.
+func WithResultCache(dir string, maxBytes int64) Option {
+	return func(r *Runner) {
+		r.cache = newResultCache(dir, maxBytes)
+	}
+}
+
+// WithMetricsAddr serves the endpoints of MetricsHandler on addr while the Runner runs.
+func WithMetricsAddr(addr string) Option {
+	return func(r *Runner) {
+		r.metricsAddr = addr
+	}
+}
+
+// WithLogger sets the logger used by the Runner.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Runner) {
+		r.logger = logger
+	}
+}
+
+// WithConcurrency sets how many tasks the Runner processes at the same time.
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		r.concurrency = n
+	}
+}
+
+// WithTypeLimit caps how many tasks of the given type run at the same time.
+// A claimed task of a type at its limit is handed back as pending, unless WithTypeFilter keeps the
+// API from returning it.
+func WithTypeLimit(workerType models.WorkerType, n int) Option {
+	return func(r *Runner) {
+		r.typeLimits[workerType] = n
+	}
+}
+
+// WithShutdownSignals sets the signals that trigger a graceful shutdown.
+// Calling it without signals disables signal handling.
+func WithShutdownSignals(signals ...os.Signal) Option {
+	return func(r *Runner) {
+		r.signals = signals
+	}
+}
+
+// WithShutdownGrace sets how long running tasks may take to finish once shutdown starts.
+func WithShutdownGrace(d time.Duration) Option {
+	return func(r *Runner) {
+		r.shutdownGrace = d
+	}
+}
+
+// WithHandBackStatus sets the status reported for tasks interrupted by a shutdown:
+// models.TaskStatusFailed (the default) or models.TaskStatusPending to requeue them.
+func WithHandBackStatus(status models.TaskStatus) Option {
+	return func(r *Runner) {
+		r.handBackStatus = status
+	}
+}
+
+// WithRejectStatus sets the status reported for claimed tasks the worker cannot process,
+// because of their type or configuration: models.TaskStatusFailed (the default) or
+// models.TaskStatusPending to hand them back to other workers.
+func WithRejectStatus(status models.TaskStatus) Option {
+	return func(r *Runner) {
+		r.rejectStatus = status
+	}
+}
+
+// WithDeadLetter retries the tasks whose handler fails, handing them back as pending with the
+// failure as status message, until they have failed threshold times; the Diagnostics bundle of such
+// a task is then uploaded as its result file, diagnostics.json, and the task reported as failed. Failures are counted from the
+// status history of the task when the API embeds it, else from the failures recorded in the work
+// directory, which only know this worker. Zero, the default, disables retries and dead-lettering.
+func WithDeadLetter(threshold int) Option {
+	return func(r *Runner) {
+		r.deadLetterThreshold = threshold
+	}
+}
+
+// WithDiagnosticsSink also stores the diagnostic bundles of dead-lettered tasks on the worker side,
+// for example with DiagnosticsDir, besides uploading them.
+func WithDiagnosticsSink(sink DiagnosticsSink) Option {
+	return func(r *Runner) {
+		r.diagnosticsSink = sink
+	}
+}
+
+// WithHeartbeatInterval sets how often the worker reports its status; zero, the default, disables heartbeats.
+// Heartbeats rely on POST /worker/heartbeat, an extension missing from the documented API: only enable
+// them against a server implementing it.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(r *Runner) {
+		r.heartbeatInterval = d
+	}
+}
+
+// WithHeartbeatPayload sets a function customizing each heartbeat before it is sent.
+func WithHeartbeatPayload(fn func(*models.HeartbeatRequest)) Option {
+	return func(r *Runner) {
+		r.heartbeatPayload = fn
+	}
+}
+
+// WithVersion sets the worker version reported in heartbeats.
+func WithVersion(version string) Option {
+	return func(r *Runner) {
+		r.version = version
+	}
+}
+
+// WithLeaseRenewal renews the lease of every running task at the given interval,
+// which must be shorter than the assignment timeout of the API; zero, the default, disables renewal.
+// Lease renewal is an extension missing from the documented API: renewal stops for an instance
+// which rejects it as not found or as a bad request, or whose client does not implement
+// services.TaskWorkerService.
+func WithLeaseRenewal(interval time.Duration) Option {
+	return func(r *Runner) {
+		r.leaseRenewal = interval
+	}
+}
+
+// WithProgressInterval sets the minimum delay between two progress updates sent for a task.
+func WithProgressInterval(d time.Duration) Option {
+	return func(r *Runner) {
+		r.progressInterval = d
+	}
+}
+
+// WithPrefetch claims the next task while every slot is busy, as soon as a running task reports
+// a progress of at least threshold percent, and downloads its source while it waits for the slot.
+// Sources larger than maxSourceSize bytes, the memory budget of a download, are only downloaded
+// once the task runs; the disk space of the task is reserved in the workspace as usual.
+// A zero threshold disables prefetching.
+func WithPrefetch(threshold float64, maxSourceSize int64) Option {
+	return func(r *Runner) {
+		r.prefetchThreshold = threshold
+		r.prefetchMaxSize = maxSourceSize
+	}
+}
+
+// WithTaskTimeout sets the maximum processing time of tasks of the given type.
+func WithTaskTimeout(workerType models.WorkerType, d time.Duration) Option {
+	return func(r *Runner) {
+		r.taskTimeouts[workerType] = d
+	}
+}
+
+// WithDefaultTaskTimeout sets the maximum processing time of tasks whose type has no specific timeout.
+func WithDefaultTaskTimeout(d time.Duration) Option {
+	return func(r *Runner) {
+		r.defaultTaskTimeout = d
+	}
+}
@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// slots tracks running tasks against the global and per-type concurrency limits.
+type slots struct {
+	mu      sync.Mutex
+	total   int
+	busy    int
+	limits  map[models.WorkerType]int
+	running map[models.WorkerType]int
+	turn    int
+	freed   chan struct{}
+}
+
+// newSlots creates the slots of a Runner; types without an explicit limit may use every slot.
+func newSlots(total int, types []models.WorkerType, limits map[models.WorkerType]int) *slots {
+	s := &slots{
+		total:   max(total, 1),
+		limits:  make(map[models.WorkerType]int),
+		running: make(map[models.WorkerType]int),
+		freed:   make(chan struct{}, 1),
+	}
+	for _, t := range types {
+		limit, ok := limits[t]
+		if !ok || limit <= 0 || limit > s.total {
+			limit = s.total
+		}
+		s.limits[t] = limit
+	}
+	return s
+}
+
+// available returns the types that currently have a free slot, fairest first:
+// the least utilized types come first, ties being rotated on every call.
+func (s *slots) available() []models.WorkerType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy >= s.total {
+		return nil
+	}
+
+	var types []models.WorkerType
+	for t, limit := range s.limits {
+		if s.running[t] < limit {
+			types = append(types, t)
+		}
+	}
+	slices.Sort(types)
+	if n := len(types); n > 1 {
+		s.turn = (s.turn + 1) % n
+		types = slices.Concat(types[s.turn:], types[:s.turn])
+	}
+	slices.SortStableFunc(types, func(a, b models.WorkerType) int {
+		ua := float64(s.running[a]) / float64(s.limits[a])
+		ub := float64(s.running[b]) / float64(s.limits[b])
+		switch {
+		case ua < ub:
+			return -1
+		case ua > ub:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return types
+}
+
+// load returns the share of busy slots.
+func (s *slots) load() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return float64(s.busy) / float64(s.total)
+}
+
+// tryAcquire takes a slot for a task of type t if one is free.
+func (s *slots) tryAcquire(t models.WorkerType) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	limit, ok := s.limits[t]
+	if !ok || s.busy >= s.total || s.running[t] >= limit {
+		return false
+	}
+	s.busy++
+	s.running[t]++
+	return true
+}
+
+// acquire waits until a slot is free for a task of type t.
+// It returns false if ctx is done first.
+func (s *slots) acquire(ctx context.Context, t models.WorkerType) bool {
+	for !s.tryAcquire(t) {
+		if !s.wait(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+// release frees the slot held by a task of type t.
+func (s *slots) release(t models.WorkerType) {
+	s.mu.Lock()
+	s.busy--
+	s.running[t]--
+	s.mu.Unlock()
+	select {
+	case s.freed <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until a slot is released or ctx is done, and reports whether ctx is still active.
+func (s *slots) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-s.freed:
+		return true
+	}
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// prefetchCheckInterval is how often the progress of running tasks is checked while every slot is busy.
+const prefetchCheckInterval = 250 * time.Millisecond
+
+// prefetch downloads the source of a claimed task while it waits for a slot.
+type prefetch struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	job    *Job
+	err    error
+}
+
+// startPrefetch allocates the scratch directory of a task and downloads its source in the background,
+// unless its result is cached or the source exceeds the prefetch memory budget; it is then downloaded
+// once the task runs.
+func (r *Runner) startPrefetch(ctx context.Context, inst *instance, task *models.Task, workerType models.WorkerType) *prefetch {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &prefetch{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.job, p.err = r.prepare(ctx, inst, task, workerType)
+		if p.err != nil {
+			return
+		}
+		if _, result, release := r.cached(p.job); result != nil {
+			release()
+			return // Nothing to download
+		}
+		if p.err = r.allocate(p.job); p.err != nil || p.job.Source.Size > r.prefetchMaxSize {
+			return
+		}
+		p.err = r.download(ctx, inst, p.job)
+	}()
+	return p
+}
+
+// wait returns the prepared job once the download is over.
+func (p *prefetch) wait() (*Job, error) {
+	<-p.done
+	return p.job, p.err
+}
+
+// discard stops the download and releases the scratch directory of a task that will not run.
+func (r *Runner) discardPrefetch(p *prefetch) {
+	p.cancel()
+	if job, _ := p.wait(); job != nil && job.Dir != "" {
+		if err := r.workspace.release(job.Dir); err != nil {
+			r.logger.Warn("failed to remove scratch directory", "dir", job.Dir, "error", err)
+		}
+	}
+}
+
+// prefetchTypes returns the types of the running tasks whose progress has reached the prefetch
+// threshold: their slot is about to free, so the next task of these types may be claimed now.
+func (r *Runner) prefetchTypes() []models.WorkerType {
+	if r.prefetchThreshold <= 0 {
+		return nil
+	}
+	types := make(map[models.WorkerType]bool)
+	for _, t := range r.running() {
+		if t.percent() >= r.prefetchThreshold {
+			types[t.workerType] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(types))
+}
+
+// waitSlot blocks until a slot is released or, when prefetching is enabled, until the progress
+// of the running tasks should be checked again.
+func (r *Runner) waitSlot(ctx context.Context) {
+	if r.prefetchThreshold > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, prefetchCheckInterval)
+		defer cancel()
+	}
+	r.slots.wait(ctx)
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+const defaultProgressInterval = 2 * time.Second
+
+// ProgressReporter lets a handler publish the progress of its task.
+type ProgressReporter interface {
+	// Report records the progress of the task, as a percentage between 0 and 100.
+	// It never blocks: updates are coalesced and sent at most once per progress interval.
+	Report(percent float64, message string)
+}
+
+// progress is the ProgressReporter of a running task. Only the latest update is kept;
+// a background goroutine sends it, then waits for the interval before sending the next one.
+type progress struct {
+	runner *Runner
+	run    *run
+
+	mu      sync.Mutex
+	percent float64
+	message string
+	pending bool
+
+	notify chan struct{}
+	done   chan struct{}
+	closed chan struct{}
+}
+
+// startProgress starts the reporter of a task; it must be stopped with stop.
+func (r *Runner) startProgress(ctx context.Context, t *run) *progress {
+	p := &progress{
+		runner: r,
+		run:    t,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	go p.loop(ctx)
+	return p
+}
+
+// Report implements ProgressReporter.
+func (p *progress) Report(percent float64, message string) {
+	p.mu.Lock()
+	// NaN cannot be encoded in JSON: the last reported percentage is kept instead.
+	if !math.IsNaN(percent) {
+		p.percent = min(max(percent, 0), 100)
+	}
+	p.message = message
+	p.pending = true
+	p.mu.Unlock()
+
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// current returns the last reported percentage.
+func (p *progress) current() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.percent
+}
+
+// loop sends the pending update whenever notified, at most once per interval.
+func (p *progress) loop(ctx context.Context) {
+	defer close(p.closed)
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.notify:
+		}
+		p.flush(ctx)
+
+		timer := time.NewTimer(p.runner.progressInterval)
+		select {
+		case <-p.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// flush sends the pending update, if any, unless the outcome of the task has been reported:
+// a processing status would then override it.
+func (p *progress) flush(ctx context.Context) {
+	p.mu.Lock()
+	if !p.pending || p.run.isSettled() {
+		p.mu.Unlock()
+		return
+	}
+	p.pending = false
+	percent, message := p.percent, p.message
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+	req := models.UpdateTaskStatusRequest{
+		Status:        models.TaskStatusProcessing,
+		StatusMessage: fmt.Sprintf("%.0f%% %s", percent, message),
+		Progress:      &percent,
+	}
+	err := p.run.inst.Client.Tasks.UpdateTaskStatus(ctx, p.run.task.ID, req)
+	switch {
+	case errors.Is(err, sdkerrors.ErrLeaseLost):
+		p.runner.loseLease(p.run)
+	case err != nil:
+		p.runner.logger.Warn("failed to report task progress", "task", p.run.task.ID, "error", err)
+	}
+}
+
+// stop ends the background goroutine and sends the last update if it has not been sent yet,
+// unless the task now belongs to another worker or has been handed back on shutdown.
+func (p *progress) stop(ctx context.Context) {
+	close(p.done)
+	<-p.closed
+	if cause := context.Cause(ctx); !errors.Is(cause, sdkerrors.ErrLeaseLost) && !errors.Is(cause, ErrShutdown) {
+		p.flush(ctx)
+	}
+}
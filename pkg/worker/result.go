@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+// outputs returns the primary output of the result followed by its attachments.
+func (r *Result) outputs() []Output {
+	return append([]Output{{Filename: r.Filename, Data: r.Data, Path: r.Path}}, r.Attachments...)
+}
+
+// size returns the size of the output.
+func (o Output) size() (int64, error) {
+	if o.Path == "" {
+		return int64(len(o.Data)), nil
+	}
+	info, err := os.Stat(o.Path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// newResult builds a result from its outputs, the first one being the primary output.
+func newResult(outputs []Output, metadata *models.ResultMetadata) *Result {
+	return &Result{
+		Filename:    outputs[0].Filename,
+		Data:        outputs[0].Data,
+		Path:        outputs[0].Path,
+		Attachments: outputs[1:],
+		Metadata:    metadata,
+	}
+}
+
+// uploadRequest describes the upload of the result; file outputs are streamed from disk.
+func (r *Result) uploadRequest() models.UploadTaskResultRequest {
+	req := models.UploadTaskResultRequest{Metadata: r.Metadata}
+	for _, o := range r.outputs() {
+		output := models.ResultOutput{Filename: o.Filename, Path: o.Path}
+		if o.Path == "" {
+			output.Reader = bytes.NewReader(o.Data)
+		}
+		req.Outputs = append(req.Outputs, output)
+	}
+	return req
+}
+
+// storeOutput writes the output to dst and returns its size. Files are hard linked when possible
+// rather than copied, the output and dst usually being on the same file system.
+func storeOutput(dst string, o Output) (int64, error) {
+	if o.Path == "" {
+		return int64(len(o.Data)), writeFileAtomic(dst, o.Data, 0o600)
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if err := os.Link(o.Path, dst); err == nil {
+		return o.size()
+	}
+	f, err := os.Open(o.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if err := writeAtomic(dst, f, 0o600); err != nil {
+		return 0, err
+	}
+	return o.size()
+}
+
+// moveFile moves the file at src to dst, copying it across file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeAtomic(dst, f, 0o600); err != nil {
+		return fmt.Errorf("failed to move %s: %w", filepath.Base(src), err)
+	}
+	return os.Remove(src)
+}
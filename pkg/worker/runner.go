@@ -0,0 +1,521 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+const (
+	defaultMinIdleDelay = time.Second
+	defaultMaxIdleDelay = 30 * time.Second
+	// reportTimeout bounds the status updates sent once the task context is done.
+	reportTimeout = 10 * time.Second
+)
+
+// Runner implements the worker loop described in docs/worker_integration.md:
+// it authenticates, polls for pending tasks, downloads their source file,
+// dispatches them to the Handler registered for their type and uploads the result.
+// A Runner may serve several instances of the API, see WithInstance.
+type Runner struct {
+	instances           []*instance
+	policy              Policy
+	nextInstance        int // Next instance to start with, for PolicyRoundRobin
+	handlers            map[models.WorkerType]Handler
+	middlewares         []Middleware
+	validators          map[models.WorkerType]ConfigValidator
+	rejectStatus        models.TaskStatus
+	registrationToken   string
+	refreshToken        string
+	credentialsFile     string
+	backoff             Backoff
+	longPoll            time.Duration
+	typeFilter          bool
+	concurrency         int
+	typeLimits          map[models.WorkerType]int
+	slots               *slots
+	signals             []os.Signal
+	shutdownGrace       time.Duration
+	handBackStatus      models.TaskStatus
+	heartbeatInterval   time.Duration
+	leaseRenewal        time.Duration
+	progressInterval    time.Duration
+	prefetchThreshold   float64
+	prefetchMaxSize     int64
+	taskTimeouts        map[models.WorkerType]time.Duration
+	defaultTaskTimeout  time.Duration
+	heartbeatPayload    func(*models.HeartbeatRequest)
+	version             string
+	workDir             string
+	diskQuota           int64
+	minFreeSpace        int64
+	workspace           *workspace
+	journal             *journal
+	cache               *resultCache
+	failureLog          *failureLog
+	deadLetterThreshold int
+	diagnosticsSink     DiagnosticsSink
+	metricsAddr         string
+	metrics             *metrics
+	logger              *slog.Logger
+
+	mu   sync.Mutex
+	runs map[string]*run
+}
+
+// NewRunner creates a Runner using client to talk to the API.
+// The client may be nil when every instance is configured with WithInstance.
+func NewRunner(client *clients.Client, opts ...Option) *Runner {
+	r := &Runner{
+		handlers:         make(map[models.WorkerType]Handler),
+		backoff:          NewExponentialBackoff(defaultMinIdleDelay, defaultMaxIdleDelay),
+		concurrency:      1,
+		typeLimits:       make(map[models.WorkerType]int),
+		taskTimeouts:     make(map[models.WorkerType]time.Duration),
+		signals:          []os.Signal{os.Interrupt, syscall.SIGTERM},
+		shutdownGrace:    defaultShutdownGrace,
+		handBackStatus:   models.TaskStatusFailed,
+		minFreeSpace:     defaultMinFreeSpace,
+		rejectStatus:     models.TaskStatusFailed,
+		validators:       make(map[models.WorkerType]ConfigValidator),
+		progressInterval: defaultProgressInterval,
+		workDir:          defaultWorkDir(),
+		logger:           slog.Default(),
+		metrics:          newMetrics(),
+		runs:             make(map[string]*run),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if client != nil {
+		primary := newInstance(Instance{
+			Name:              DefaultInstance,
+			Client:            client,
+			RegistrationToken: r.registrationToken,
+			RefreshToken:      r.refreshToken,
+			CredentialsFile:   r.credentialsFile,
+		})
+		r.instances = append([]*instance{primary}, r.instances...)
+	}
+	for workerType, h := range r.handlers {
+		if v, ok := h.(ConfigValidator); ok {
+			r.validators[workerType] = v
+		}
+		r.handlers[workerType] = Chain(h, r.middlewares...)
+	}
+	r.slots = newSlots(r.concurrency, slices.Collect(maps.Keys(r.handlers)), r.typeLimits)
+	r.workspace = newWorkspace(r.workDir, r.diskQuota, r.minFreeSpace)
+	r.journal = newJournal(r.workDir)
+	if r.deadLetterThreshold > 0 {
+		r.failureLog = newFailureLog(r.workDir)
+	}
+	return r
+}
+
+// defaultWorkDir returns the work directory used without WithWorkDir. It is kept across restarts
+// so that the tasks interrupted by a crash are recovered.
+func defaultWorkDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "qalpuch-worker")
+}
+
+// Run processes tasks until ctx is cancelled or a shutdown signal is received.
+// A task is only claimed when a slot is free for at least one of the handled types.
+// On shutdown, running tasks are given the grace period to finish; the remaining
+// ones are interrupted and handed back before Run returns.
+func (r *Runner) Run(ctx context.Context) error {
+	if len(r.handlers) == 0 {
+		return errors.New("worker: no handler registered")
+	}
+	if err := r.validateInstances(); err != nil {
+		return err
+	}
+	if len(r.signals) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, r.signals...)
+		defer stop()
+	}
+	removed, err := r.workspace.init()
+	if err != nil {
+		return err
+	}
+	defer r.workspace.close()
+	if removed > 0 {
+		r.logger.Info("removed task directories left by a previous run", "count", removed)
+	}
+	stopMetrics, err := r.serveMetrics()
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	for _, inst := range r.instances {
+		if err := r.authenticate(ctx, inst); err != nil {
+			return err
+		}
+	}
+	if r.cache != nil {
+		if err := r.cache.load(); err != nil {
+			return err
+		}
+	}
+	if r.failureLog != nil {
+		if err := r.failureLog.load(); err != nil {
+			return err
+		}
+	}
+	if err := r.recoverJournal(ctx); err != nil {
+		r.logger.Error("failed to recover tasks interrupted by a restart", "error", err)
+	}
+
+	// Handlers run on a context that outlives ctx so that they can finish during the grace period.
+	work, cancelWork := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancelWork(nil)
+
+	stopHeartbeat := r.startHeartbeat(work)
+	defer stopHeartbeat()
+
+	var wg sync.WaitGroup
+	defer r.shutdown(&wg, cancelWork)
+
+	for ctx.Err() == nil {
+		types := r.slots.available()
+		if len(types) == 0 {
+			types = r.prefetchTypes()
+		}
+		if len(types) == 0 {
+			r.waitSlot(ctx)
+			continue
+		}
+		if !r.workspace.hasRoom() {
+			r.logger.Warn("not enough disk space to claim a task", "dir", r.workDir)
+			if !sleep(ctx, r.backoff.Next()) {
+				return nil
+			}
+			continue
+		}
+
+		task, inst, err := r.poll(ctx, types)
+		if err == nil {
+			if !r.dispatch(ctx, work, &wg, inst, types, task) {
+				r.backoff.Reset()
+				continue
+			}
+			// The task did not fit the polled types: wait before claiming the same task again.
+		}
+		if ctx.Err() != nil || !sleep(ctx, r.backoff.Next()) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// dispatch processes a claimed task in its own goroutine once a slot of its type is free.
+// A task whose type is not among the polled types, which the API may not filter, is handed back
+// as pending for another worker and dispatch reports it as requeued.
+// The task runs on work rather than ctx, which only governs the wait for a slot.
+// The task is tracked and its lease renewed from its claim, so that a task waiting for a slot is
+// reported and kept like a running one; when prefetching is enabled, its source is downloaded meanwhile.
+func (r *Runner) dispatch(ctx, work context.Context, wg *sync.WaitGroup, inst *instance, types []models.WorkerType, task *models.Task) (requeued bool) {
+	workerType, err := r.check(task)
+	t := &run{task: task, inst: inst, workerType: workerType, started: time.Now()}
+	r.count(t, claimedTasks)
+	if err != nil {
+		r.finish(ctx, t, r.rejectStatus, err.Error())
+		return false
+	}
+	if !slices.Contains(types, workerType) {
+		r.finish(ctx, t, models.TaskStatusPending, fmt.Sprintf("no free slot for %s tasks", workerType))
+		return true
+	}
+
+	taskCtx, cancel := context.WithCancelCause(work)
+	t.cancel = cancel
+	r.track(t)
+	r.record(t, PhaseDownloading)
+	done := func() {
+		cancel(nil)
+		r.forget(t.key())
+		r.untrack(t)
+	}
+	if r.leaseRenewal > 0 {
+		go r.renewLease(taskCtx, t)
+	}
+	if err := r.report(ctx, inst, task.ID, models.TaskStatusProcessing, "Task accepted by worker"); errors.Is(err, sdkerrors.ErrLeaseLost) {
+		r.loseLease(t)
+		done()
+		return false
+	}
+
+	var pf *prefetch
+	if !r.slots.tryAcquire(workerType) {
+		if r.prefetchThreshold > 0 {
+			pf = r.startPrefetch(taskCtx, inst, task, workerType)
+		}
+		// A lease lost during the wait abandons the task as well.
+		waitCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		context.AfterFunc(taskCtx, stop)
+		if !r.slots.acquire(waitCtx, workerType) {
+			if pf != nil {
+				r.discardPrefetch(pf)
+			}
+			r.handBack(ctx, t, "Worker shutting down before processing the task")
+			done()
+			return false
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer r.slots.release(workerType)
+		defer done()
+		r.process(taskCtx, t, pf)
+	}()
+	return false
+}
+
+// process runs a claimed task to completion and reports its outcome.
+// pf, if not nil, holds the job prefetched while the task waited for a slot.
+func (r *Runner) process(ctx context.Context, t *run, pf *prefetch) {
+	task := t.task
+	logger := r.logger.With("task", task.ID, "instance", t.inst.Name)
+	h := r.handlers[t.workerType]
+
+	if ctx.Err() != nil {
+		return // Abandoned while waiting for a slot
+	}
+
+	var job *Job
+	var err error
+	if pf != nil {
+		job, err = pf.wait()
+	} else {
+		job, err = r.prepare(ctx, t.inst, task, t.workerType)
+	}
+	defer func() {
+		if job != nil && job.Dir != "" {
+			if err := r.workspace.release(job.Dir); err != nil {
+				logger.Warn("failed to remove scratch directory", "dir", job.Dir, "error", err)
+			}
+		}
+	}()
+
+	// A cached result is uploaded without reserving space for the task nor downloading its source.
+	var key string
+	if err == nil {
+		var result *Result
+		var release func()
+		if key, result, release = r.cached(job); result != nil {
+			defer release()
+			logger.Info("reusing cached result", "type", t.workerType)
+			r.upload(ctx, t, result)
+			return
+		}
+		if job.Dir == "" {
+			err = r.allocate(job)
+		}
+	}
+	if errors.Is(err, ErrInsufficientSpace) {
+		// Another worker may have the space: the task is requeued whatever the hand-back status.
+		logger.Warn("handing back task", "error", err)
+		if t.settle() {
+			r.report(ctx, t.inst, task.ID, models.TaskStatusPending, err.Error())
+		}
+		return
+	}
+	if err != nil {
+		r.finish(ctx, t, models.TaskStatusFailed, err.Error())
+		return
+	}
+	if job.SourcePath == "" {
+		if err := r.download(ctx, t.inst, job); err != nil {
+			r.finish(ctx, t, models.TaskStatusFailed, err.Error())
+			return
+		}
+	}
+
+	r.record(t, PhaseProcessing)
+	logger.Info("processing task", "type", t.workerType)
+	progress := r.startProgress(ctx, t)
+	t.setProgress(progress)
+	job.Progress = progress
+	invoked := time.Now()
+	result, returned, err := r.invoke(ctx, h, job)
+	if returned != nil {
+		// Runs before the directory and the slot are released.
+		defer func() {
+			<-returned
+			logger.Warn("abandoned handler returned, releasing its slot and directory")
+		}()
+	}
+	r.metrics.observeHandler(t.workerType, time.Since(invoked))
+	progress.stop(ctx)
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		logger.Error("handler panicked", "panic", panicErr.Value, "stack", string(panicErr.Stack))
+	}
+	if err == nil && result == nil {
+		err = errors.New("handler returned no result")
+	}
+	if err != nil {
+		r.fail(ctx, t, job, err)
+		return
+	}
+	if key != "" {
+		if err := r.cache.put(key, result); err != nil {
+			logger.Warn("failed to cache result", "error", err)
+		}
+	}
+	r.upload(ctx, t, result)
+}
+
+// upload sends the result of a task and reports its success.
+func (r *Runner) upload(ctx context.Context, t *run, result *Result) {
+	logger := r.logger.With("task", t.task.ID, "instance", t.inst.Name)
+	if saved, err := r.journal.saveResult(t, result); err != nil {
+		logger.Warn("failed to save result before upload", "error", err)
+	} else {
+		result = saved
+	}
+	if err := t.inst.uploadResult(ctx, t.task.ID, result); err != nil {
+		if errors.Is(err, sdkerrors.ErrLeaseLost) {
+			r.loseLease(t)
+			return
+		}
+		r.finish(ctx, t, models.TaskStatusFailed, fmt.Sprintf("failed to upload result: %v", err))
+		return
+	}
+	if r.failureLog != nil {
+		if err := r.failureLog.set(t.key(), 0); err != nil {
+			logger.Warn("failed to record task failure", "error", err)
+		}
+	}
+	if t.settle() {
+		r.count(t, succeededTasks)
+		logger.Info("task completed", "duration", time.Since(t.started))
+	}
+}
+
+// prepare fetches the metadata of the source file of a task. The scratch directory of the job
+// is reserved by allocate, once the result cache has been consulted.
+func (r *Runner) prepare(ctx context.Context, inst *instance, task *models.Task, workerType models.WorkerType) (*Job, error) {
+	if task.SourceFileID == nil || *task.SourceFileID == "" {
+		return nil, errors.New("task has no source file")
+	}
+
+	source, err := inst.Client.Files.GetFileMetadata(ctx, *task.SourceFileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source file metadata: %w", err)
+	}
+	return &Job{Task: *task, Type: workerType, Source: source}, nil
+}
+
+// cached returns the cache key of a job, empty if its result cannot be cached, and its cached result if any,
+// which stays in the cache until release is called.
+func (r *Runner) cached(job *Job) (key string, result *Result, release func()) {
+	if r.cache == nil {
+		return "", nil, nil
+	}
+	key = cacheKey(job)
+	if key == "" {
+		return "", nil, nil
+	}
+	result, release, _ = r.cache.get(key)
+	return key, result, release
+}
+
+// allocate reserves the scratch directory of a job. The source file itself is downloaded by download.
+func (r *Runner) allocate(job *Job) error {
+	dir, err := r.workspace.allocate(job.Source.Size)
+	if err != nil {
+		return err
+	}
+	job.Dir = dir
+	return nil
+}
+
+// download writes the source file of the job into its scratch directory.
+func (r *Runner) download(ctx context.Context, inst *instance, job *Job) error {
+	data, err := inst.Client.Files.DownloadFile(ctx, job.Source.ID)
+	if err != nil {
+		return fmt.Errorf("failed to download source file: %w", err)
+	}
+
+	name := filepath.Base(job.Source.Filename)
+	if name == "." || name == string(filepath.Separator) {
+		name = "source"
+	}
+	path := filepath.Join(job.Dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write source file: %w", err)
+	}
+	job.SourcePath = path
+	return nil
+}
+
+// record journals the phase of a task; the task goes on if the journal cannot be written.
+func (r *Runner) record(t *run, phase Phase) {
+	if err := r.journal.record(t, phase); err != nil {
+		r.logger.Warn("failed to write journal", "task", t.task.ID, "error", err)
+	}
+}
+
+// forget clears the journal entry of a task whose outcome has been reported; key is given by run.key.
+func (r *Runner) forget(key string) {
+	if err := r.journal.remove(key); err != nil {
+		r.logger.Warn("failed to write journal", "task", key, "error", err)
+	}
+}
+
+// finish reports the final status of a task, unless its outcome has already been reported.
+func (r *Runner) finish(ctx context.Context, t *run, status models.TaskStatus, message string) {
+	if !t.settle() {
+		return
+	}
+	if status == models.TaskStatusFailed {
+		r.count(t, failedTasks)
+		r.logger.Warn("task failed", "task", t.task.ID, "instance", t.inst.Name, "reason", message)
+	}
+	r.report(ctx, t.inst, t.task.ID, status, truncate(message, maxStatusMessageLength))
+}
+
+// report sends a status update to an instance, even when ctx is already cancelled.
+func (r *Runner) report(ctx context.Context, inst *instance, taskID string, status models.TaskStatus, message string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+	req := models.UpdateTaskStatusRequest{Status: status, StatusMessage: message}
+	err := inst.Client.Tasks.UpdateTaskStatus(ctx, taskID, req)
+	if err != nil {
+		r.logger.Error("failed to update task status", "task", taskID, "instance", inst.Name, "status", status, "error", err)
+	}
+	return err
+}
+
+// sleep waits for d and reports whether ctx is still active.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
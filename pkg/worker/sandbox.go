@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultSandboxPath is the PATH of sandboxed commands whose environment does not set one.
+const defaultSandboxPath = "/usr/local/bin:/usr/bin:/bin"
+
+// Sandbox restricts the processes started by an ExecHandler.
+// Zero limits are not enforced. Resource limits and User are only supported on Linux;
+// the limits are set by /bin/sh before it executes the command, and are inherited by its children.
+type Sandbox struct {
+	CPUTime      time.Duration // CPU time, rounded up to the second
+	AddressSpace uint64        // Virtual memory, in bytes
+	OpenFiles    uint64        // Open file descriptors
+	FileSize     uint64        // Size of the files written, in bytes
+
+	// Dir is where the working directory of each task is created; empty uses the job directory.
+	// The working directory is also the output directory of the command and is removed afterwards.
+	Dir string
+	// Env replaces the environment of the worker. HOME and TMPDIR point to the working directory,
+	// and PATH defaults to defaultSandboxPath.
+	Env []string
+	// User runs the command with the given credentials instead of those of the worker.
+	User *SandboxUser
+}
+
+// SandboxUser is the unprivileged identity of a sandboxed command.
+type SandboxUser struct {
+	UID uint32
+	GID uint32
+}
+
+// LimitError is returned when a sandboxed command is stopped by one of its resource limits.
+type LimitError struct {
+	Resource string // "cpu time", "address space", "open files" or "file size"
+	Limit    string
+	Err      error
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("external handler exceeded its %s limit (%s): %v", e.Resource, e.Limit, e.Err)
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// workDir creates the working directory of a job and gives the sandbox user access to it and to the source file.
+func (s *Sandbox) workDir(job *Job) (string, error) {
+	parent := s.Dir
+	if parent == "" {
+		parent = job.Dir
+	}
+	dir, err := os.MkdirTemp(parent, "sandbox-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	if s.User != nil {
+		for _, path := range []string{dir, job.Dir, job.SourcePath} {
+			if err := os.Lchown(path, int(s.User.UID), int(s.User.GID)); err != nil {
+				_ = os.RemoveAll(dir)
+				return "", fmt.Errorf("failed to hand %s to the sandbox user: %w", path, err)
+			}
+		}
+	}
+	return dir, nil
+}
+
+// environ returns the scrubbed environment of a command running in dir.
+func (s *Sandbox) environ(dir string, extra []string) []string {
+	env := []string{"PATH=" + defaultSandboxPath, "HOME=" + dir, "TMPDIR=" + dir}
+	return append(append(env, s.Env...), extra...)
+}
+
+// limitHit explains a failure caused by a resource limit, or returns nil.
+// Signals identify the CPU time and file size limits; the other limits are recognized from
+// the standard error of the command, as the kernel only makes the offending call fail.
+func (s *Sandbox) limitHit(err *ExecError) *LimitError {
+	switch exitSignal(err) {
+	case sigCPU:
+		if s.CPUTime > 0 {
+			return &LimitError{Resource: "cpu time", Limit: s.CPUTime.String(), Err: err}
+		}
+	case sigFileSize:
+		if s.FileSize > 0 {
+			return &LimitError{Resource: "file size", Limit: fmt.Sprintf("%d bytes", s.FileSize), Err: err}
+		}
+	}
+	lower := strings.ToLower(err.Stderr)
+	switch {
+	case s.OpenFiles > 0 && strings.Contains(lower, "too many open files"):
+		return &LimitError{Resource: "open files", Limit: fmt.Sprint(s.OpenFiles), Err: err}
+	case s.AddressSpace > 0 && (strings.Contains(lower, "cannot allocate memory") || strings.Contains(lower, "out of memory")):
+		return &LimitError{Resource: "address space", Limit: fmt.Sprintf("%d bytes", s.AddressSpace), Err: err}
+	}
+	return nil
+}
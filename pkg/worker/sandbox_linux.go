@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// limitShell runs the command of a sandbox with resource limits, set before it is executed.
+const limitShell = "/bin/sh"
+
+// configure runs the command as the sandbox user, with the resource limits of the sandbox.
+func (s *Sandbox) configure(cmd *exec.Cmd) error {
+	if s.User != nil {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		// An empty Groups clears the supplementary groups of the worker.
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: s.User.UID, Gid: s.User.GID, Groups: []uint32{}}
+	}
+	if script := s.ulimit(); script != "" && cmd.Err == nil {
+		args := append([]string{"sh", "-c", script + ` || exit 126; exec "$@"`, "sandbox", cmd.Path}, cmd.Args[1:]...)
+		cmd.Path, cmd.Args = limitShell, args
+	}
+	return nil
+}
+
+// ulimit returns the shell commands setting the resource limits, which the command and its children inherit.
+// The CPU time hard limit is one second above the soft one so that SIGXCPU is delivered before SIGKILL.
+// Sizes are rounded up to the units of ulimit: KiB for the address space, 512-byte blocks for files.
+func (s *Sandbox) ulimit() string {
+	var limits []string
+	if s.CPUTime > 0 {
+		seconds := uint64((s.CPUTime + time.Second - 1) / time.Second)
+		// The soft limit goes first: a hard limit below the current soft one is rejected.
+		limits = append(limits, fmt.Sprintf("ulimit -S -t %d", seconds), fmt.Sprintf("ulimit -H -t %d", seconds+1))
+	}
+	if s.AddressSpace > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", (s.AddressSpace+1023)/1024))
+	}
+	if s.OpenFiles > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -n %d", s.OpenFiles))
+	}
+	if s.FileSize > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -f %d", (s.FileSize+511)/512))
+	}
+	return strings.Join(limits, " && ")
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package worker
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// errSandboxUnsupported is returned when a Sandbox asks for resource limits or a user on this platform.
+var errSandboxUnsupported = errors.New("worker: sandbox limits and users are only supported on Linux")
+
+// configure fails if a resource limit or a user is configured.
+func (s *Sandbox) configure(cmd *exec.Cmd) error {
+	if s.User != nil || s.CPUTime > 0 || s.AddressSpace > 0 || s.OpenFiles > 0 || s.FileSize > 0 {
+		return errSandboxUnsupported
+	}
+	return nil
+}
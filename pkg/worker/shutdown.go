@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+const defaultShutdownGrace = 30 * time.Second
+
+// ErrShutdown is the cause of the handler context cancellation when the
+// Runner interrupts a task because the shutdown grace period has expired.
+var ErrShutdown = errors.New("worker: shutting down")
+
+// run is the state of a task being processed by the Runner.
+type run struct {
+	task       *models.Task
+	inst       *instance // Instance the task was claimed from
+	workerType models.WorkerType
+	started    time.Time
+	cancel     context.CancelCauseFunc
+
+	mu       sync.Mutex
+	settled  bool
+	progress *progress
+}
+
+// key identifies the task among those of every instance.
+func (t *run) key() string {
+	return t.inst.Name + "/" + t.task.ID
+}
+
+// settle records that the outcome of the task has been reported.
+// It returns false if another outcome has already been reported.
+func (t *run) settle() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.settled {
+		return false
+	}
+	t.settled = true
+	return true
+}
+
+// isSettled reports whether the outcome of the task has been reported.
+func (t *run) isSettled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.settled
+}
+
+// setProgress attaches the progress reporter of the task once its handler starts.
+func (t *run) setProgress(p *progress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progress = p
+}
+
+// percent returns the last progress reported by the handler of the task.
+func (t *run) percent() float64 {
+	t.mu.Lock()
+	p := t.progress
+	t.mu.Unlock()
+	if p == nil {
+		return 0
+	}
+	return p.current()
+}
+
+// track registers a task being processed.
+func (r *Runner) track(t *run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runs[t.key()] = t
+}
+
+// untrack removes a task once processed.
+func (r *Runner) untrack(t *run) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runs, t.key())
+}
+
+// running returns the tasks currently being processed.
+func (r *Runner) running() []*run {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := make([]*run, 0, len(r.runs))
+	for _, t := range r.runs {
+		runs = append(runs, t)
+	}
+	return runs
+}
+
+// shutdown lets running tasks finish within the grace period, then interrupts
+// the remaining ones and hands them back to the API.
+func (r *Runner) shutdown(wg *sync.WaitGroup, cancelWork context.CancelCauseFunc) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	grace := time.NewTimer(r.shutdownGrace)
+	defer grace.Stop()
+	select {
+	case <-done:
+		return
+	case <-grace.C:
+	}
+
+	// Settle the tasks before interrupting them so that their handlers cannot report a failure first.
+	var interrupted []*run
+	for _, t := range r.running() {
+		if t.settle() {
+			interrupted = append(interrupted, t)
+		}
+	}
+	r.logger.Warn("shutdown grace period expired, interrupting running tasks", "count", len(interrupted))
+	cancelWork(ErrShutdown)
+	for _, t := range interrupted {
+		r.report(context.Background(), t.inst, t.task.ID, r.handBackStatus, "Worker shutting down: task interrupted")
+		r.forget(t.key())
+	}
+
+	select {
+	case <-done:
+	case <-time.After(reportTimeout):
+		r.logger.Warn("some handlers did not return after being interrupted")
+	}
+}
+
+// handBack reports a task that the worker gives up without a failure of its own.
+func (r *Runner) handBack(ctx context.Context, t *run, message string) {
+	if t.settle() {
+		r.report(ctx, t.inst, t.task.ID, r.handBackStatus, message)
+	}
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxStatusMessageLength bounds the diagnostic messages sent with status updates.
+	maxStatusMessageLength = 1024
+	// abandonDelay is how long a handler may take to return once its context is done
+	// before the Runner reports its task without waiting for it.
+	abandonDelay = 5 * time.Second
+)
+
+// ErrTaskTimeout is the cause of the handler context cancellation when a task exceeds its deadline.
+var ErrTaskTimeout = errors.New("worker: task deadline exceeded")
+
+// PanicError is returned for a handler that panicked.
+// Its message only names the function that panicked; the full stack is logged by the Runner.
+type PanicError struct {
+	Value interface{}
+	Frame string // Function and location of the panic
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	if e.Frame == "" {
+		return fmt.Sprintf("handler panicked: %v", e.Value)
+	}
+	return fmt.Sprintf("handler panicked: %v at %s", e.Value, e.Frame)
+}
+
+// panicFrame returns the frame that panicked, for a function deferred by the caller of panicFrame.
+func panicFrame() string {
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers, panicFrame and the deferred function.
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s (%s:%d)", frame.Function, filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// invoke runs the handler under the deadline of its task type and turns panics into errors.
+// A handler that ignores the cancellation of its context is abandoned after abandonDelay: its
+// task can then be reported, but the handler may still use the slot and the directory of the job.
+// The returned channel, nil unless the handler was abandoned, is closed once the handler returns.
+func (r *Runner) invoke(ctx context.Context, h Handler, job *Job) (*Result, <-chan struct{}, error) {
+	timeout, ok := r.taskTimeouts[job.Type]
+	if !ok {
+		timeout = r.defaultTaskTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, ErrTaskTimeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		result *Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		defer func() {
+			if v := recover(); v != nil {
+				done <- outcome{err: &PanicError{Value: v, Frame: panicFrame(), Stack: debug.Stack()}}
+			}
+		}()
+		result, err := h.Handle(ctx, job)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, nil, o.err
+	case <-ctx.Done():
+	}
+
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrTaskTimeout) {
+		cause = fmt.Errorf("%w after %s", ErrTaskTimeout, timeout)
+	}
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", cause, o.err)
+		}
+		return nil, nil, cause
+	case <-time.After(abandonDelay):
+		r.logger.Error("handler did not return after cancellation, abandoning it: its slot and directory stay reserved until it returns",
+			"task", job.Task.ID, "dir", job.Dir)
+		return nil, returned, cause
+	}
+}
+
+// truncate shortens message to at most n bytes without splitting a UTF-8 sequence.
+func truncate(message string, n int) string {
+	if len(message) <= n {
+		return message
+	}
+	const ellipsis = "..."
+	cut := n - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(message[cut]) {
+		cut--
+	}
+	return message[:cut] + ellipsis
+}
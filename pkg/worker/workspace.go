@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// taskDirPrefix names the per-task directories of a workspace.
+	taskDirPrefix = "task-"
+	// spaceFactor is the disk space reserved for a task, as a multiple of its source size,
+	// to leave room for the output next to the source.
+	spaceFactor = 2
+	// defaultMinFreeSpace is the disk space below which no task is claimed, see WithMinFreeSpace.
+	defaultMinFreeSpace = 64 << 20
+	// lockFileName is locked by the Runner using a workspace, see WithWorkDir.
+	lockFileName = ".lock"
+)
+
+// ErrInsufficientSpace is returned when the workspace cannot hold the files of a task.
+var ErrInsufficientSpace = errors.New("worker: insufficient disk space")
+
+// errWorkDirLocked is returned when another worker uses the work directory.
+var errWorkDirLocked = errors.New("worker: work directory is used by another worker")
+
+// workspace allocates the per-task directories of a Runner under root.
+// The space of each task is reserved from its source size until its directory is released.
+type workspace struct {
+	root    string
+	quota   int64 // Total space reserved by running tasks; zero is unlimited
+	minFree int64 // Space to keep free on the disk
+
+	mu       sync.Mutex
+	reserved map[string]int64
+	total    int64
+	unlock   func()
+}
+
+func newWorkspace(root string, quota, minFree int64) *workspace {
+	return &workspace{root: root, quota: quota, minFree: minFree, reserved: make(map[string]int64)}
+}
+
+// init creates the root directory, locks it until close and removes the task directories left by
+// a previous run. It fails when another worker holds the lock.
+func (w *workspace) init() (removed int, err error) {
+	if err := os.MkdirAll(w.root, 0o700); err != nil {
+		return 0, fmt.Errorf("worker: failed to create work directory: %w", err)
+	}
+	unlock, err := lockFile(filepath.Join(w.root, lockFileName))
+	if errors.Is(err, errWorkDirLocked) {
+		return 0, fmt.Errorf("%w: %s", err, w.root)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("worker: failed to lock work directory: %w", err)
+	}
+	w.unlock = unlock
+	entries, err := os.ReadDir(w.root)
+	if err != nil {
+		return 0, fmt.Errorf("worker: failed to read work directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), taskDirPrefix) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(w.root, entry.Name())); err != nil {
+			w.close()
+			return removed, fmt.Errorf("worker: failed to remove stale task directory: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// close releases the lock taken by init.
+func (w *workspace) close() {
+	if w.unlock != nil {
+		w.unlock()
+		w.unlock = nil
+	}
+}
+
+// hasRoom reports whether another task may be claimed: the quota is not exhausted and the disk
+// has more free space than the configured minimum once the reservations of running tasks are written.
+// It is checked before polling since the size of a task is only known once it has been claimed.
+func (w *workspace) hasRoom() bool {
+	w.mu.Lock()
+	reserved := w.total
+	w.mu.Unlock()
+	if w.quota > 0 && reserved >= w.quota {
+		return false
+	}
+	free, ok := freeSpace(w.root)
+	return !ok || free-reserved > w.minFree
+}
+
+// allocate reserves the space of a task whose source has the given size and creates its directory.
+func (w *workspace) allocate(sourceSize int64) (string, error) {
+	need := max(sourceSize, 0) * spaceFactor
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.quota > 0 && w.total+need > w.quota {
+		return "", fmt.Errorf("%w: %d bytes needed, %d of the %d bytes quota available", ErrInsufficientSpace, need, w.quota-w.total, w.quota)
+	}
+	if free, ok := freeSpace(w.root); ok {
+		// Reservations of running tasks may not be written yet.
+		if available := free - w.total - w.minFree; need > available {
+			return "", fmt.Errorf("%w: %d bytes needed, %d available", ErrInsufficientSpace, need, max(available, 0))
+		}
+	}
+
+	dir, err := os.MkdirTemp(w.root, taskDirPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	w.reserved[dir] = need
+	w.total += need
+	return dir, nil
+}
+
+// release removes the directory of a task and frees its reservation.
+func (w *workspace) release(dir string) error {
+	w.mu.Lock()
+	w.total -= w.reserved[dir]
+	delete(w.reserved, dir)
+	w.mu.Unlock()
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the file at path, released when the process exits.
+// It returns errWorkDirLocked when another process holds the lock.
+func lockFile(path string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errWorkDirLocked
+		}
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
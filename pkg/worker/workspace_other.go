@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package worker
+
+// freeSpace is not supported on this platform: only the quota is enforced.
+func freeSpace(path string) (int64, bool) {
+	return 0, false
+}
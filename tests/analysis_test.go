@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/analysis"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+)
+
+func analysisTask(id string, workerType models.WorkerType, created time.Time, queue, processing time.Duration, final models.TaskStatus, message string) models.Task {
+	updated := created.Add(queue + processing)
+	return models.Task{
+		ID:        id,
+		Config:    `{"type":"` + string(workerType) + `"}`,
+		Status:    final,
+		CreatedAt: &created,
+		UpdatedAt: &updated,
+		Logs: []models.Log{
+			{ID: id + "-done", TaskStatus: final, Message: message, CreatedAt: updated},
+			{ID: id + "-start", TaskStatus: models.TaskStatusProcessing, Message: "started", CreatedAt: created.Add(queue)},
+		},
+	}
+}
+
+func TestAnalysis_NewTimeline(t *testing.T) {
+	created := time.Date(2025, 9, 17, 10, 0, 0, 0, time.UTC)
+	task := analysisTask("task1", models.WorkerTypeVideo, created, time.Minute, 5*time.Minute, models.TaskStatusFailed, "corrupted source")
+
+	tl := analysis.NewTimeline(task)
+
+	if tl.Type != models.WorkerTypeVideo {
+		t.Errorf("Expected type 'video', got '%s'", tl.Type)
+	}
+	if len(tl.Events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(tl.Events))
+	}
+	if d, ok := tl.QueueTime(); !ok || d != time.Minute {
+		t.Errorf("Expected queue time 1m, got %v (%v)", d, ok)
+	}
+	if d, ok := tl.ProcessingTime(); !ok || d != 5*time.Minute {
+		t.Errorf("Expected processing time 5m, got %v (%v)", d, ok)
+	}
+	if tl.FailureReason != "corrupted source" {
+		t.Errorf("Expected failure reason 'corrupted source', got '%s'", tl.FailureReason)
+	}
+}
+
+func TestAnalysis_TimelineOfRetriedTask(t *testing.T) {
+	created := time.Date(2025, 9, 17, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return created.Add(time.Duration(minutes) * time.Minute) }
+	task := models.Task{
+		ID:        "retried",
+		Config:    `{"type":"image"}`,
+		Status:    models.TaskStatusCompleted,
+		CreatedAt: &created,
+		Logs: []models.Log{
+			{ID: "1", TaskStatus: models.TaskStatusProcessing, CreatedAt: at(1)},
+			{ID: "2", TaskStatus: models.TaskStatusFailed, Message: "crashed", CreatedAt: at(2)},
+			{ID: "3", TaskStatus: models.TaskStatusPending, Message: "processing failed: timeout", CreatedAt: at(3)},
+			{ID: "4", TaskStatus: models.TaskStatusProcessing, CreatedAt: at(4)},
+			{ID: "5", TaskStatus: models.TaskStatusPending, Message: "processing failed: timeout", CreatedAt: at(5)},
+			{ID: "6", TaskStatus: models.TaskStatusProcessing, CreatedAt: at(6)},
+			{ID: "7", TaskStatus: models.TaskStatusCompleted, CreatedAt: at(8)},
+		},
+	}
+
+	tl := analysis.NewTimeline(task)
+	if tl.Status != models.TaskStatusCompleted || tl.FailureReason != "" || tl.Retries != 2 {
+		t.Errorf("Expected a task completed after 2 retries, got %+v", tl)
+	}
+	if d, ok := tl.ProcessingTime(); !ok || d != 7*time.Minute {
+		t.Errorf("Expected processing time 7m, got %v (%v)", d, ok)
+	}
+
+	// While retried, the task is not finished.
+	task.Status = models.TaskStatusPending
+	task.Logs = task.Logs[:3]
+	if tl := analysis.NewTimeline(task); tl.Status != models.TaskStatusPending || !tl.FinishedAt.IsZero() || tl.Retries != 1 {
+		t.Errorf("Expected a pending task retried once, got %+v", tl)
+	}
+}
+
+func TestAnalysis_TimelineOmitsMissingTimes(t *testing.T) {
+	created := time.Date(2025, 9, 17, 10, 0, 0, 0, time.UTC)
+	tl := analysis.NewTimeline(models.Task{ID: "queued", Status: models.TaskStatusPending, CreatedAt: &created})
+
+	data, err := json.Marshal(tl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "startedAt") || strings.Contains(string(data), "finishedAt") {
+		t.Errorf("Expected no start or finish time for a queued task, got %s", data)
+	}
+	if data, _ := json.Marshal(analysis.NewTimeline(models.Task{ID: "unknown"})); strings.Contains(string(data), "createdAt") {
+		t.Errorf("Expected no creation time when unknown, got %s", data)
+	}
+}
+
+func TestAnalysis_Analyze(t *testing.T) {
+	created := time.Date(2025, 9, 17, 10, 0, 0, 0, time.UTC)
+	tasks := []models.Task{
+		analysisTask("img1", models.WorkerTypeImage, created, time.Second, 10*time.Second, models.TaskStatusCompleted, ""),
+		analysisTask("img2", models.WorkerTypeImage, created, 3*time.Second, 20*time.Second, models.TaskStatusCompleted, ""),
+		analysisTask("img3", models.WorkerTypeImage, created, 2*time.Second, 30*time.Second, models.TaskStatusFailed, "unsupported format"),
+		analysisTask("vid1", models.WorkerTypeVideo, created, time.Minute, time.Hour, models.TaskStatusCompleted, ""),
+	}
+
+	report := analysis.Analyze(tasks)
+
+	if len(report.Types) != 2 {
+		t.Fatalf("Expected 2 types, got %d", len(report.Types))
+	}
+	images := report.Types[0]
+	if images.Type != models.WorkerTypeImage || images.Total != 3 || images.Failed != 1 {
+		t.Errorf("Unexpected image stats: %+v", images)
+	}
+	if images.ProcessingTime.P50 != 20*time.Second || images.ProcessingTime.P95 != 30*time.Second {
+		t.Errorf("Expected processing p50 20s and p95 30s, got %v and %v", images.ProcessingTime.P50, images.ProcessingTime.P95)
+	}
+	if images.FailureReasons["unsupported format"] != 1 {
+		t.Errorf("Expected failure reason to be counted, got %v", images.FailureReasons)
+	}
+
+	var csvOut bytes.Buffer
+	if err := report.WriteCSV(&csvOut); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n"); len(lines) != 3 {
+		t.Errorf("Expected 3 CSV lines, got %d", len(lines))
+	}
+
+	var jsonOut bytes.Buffer
+	if err := report.WriteJSON(&jsonOut); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(jsonOut.Bytes(), &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON report: %v", err)
+	}
+}
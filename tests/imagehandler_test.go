@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker/imagehandler"
+)
+
+// testPNG encodes a width x height image, red on the left half and blue on the right half.
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= width/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader returns the start of a PNG file declaring a width x height image, without its pixels.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 0, 17)
+	ihdr = append(ihdr, "IHDR"...)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8-bit RGB
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, 13)
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestImageHandler_EndToEnd(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	source := testPNG(t, 40, 20)
+	api.addTaskWithConfig("jpeg", `{"type":"image","format":"jpeg","quality":90,"width":20}`, source)
+	api.addTaskWithConfig("png", `{"type":"image","width":80,"height":10}`, source)
+	api.addTaskWithConfig("webp", `{"type":"image","format":"webp"}`, source)
+	api.addTaskWithConfig("broken", `{"type":"image","format":"png"}`, []byte("not an image"))
+	var empty bytes.Buffer
+	if err := gif.Encode(&empty, image.NewPaletted(image.Rect(0, 0, 0, 0), palette.Plan9), nil); err != nil {
+		t.Fatal(err)
+	}
+	api.addTaskWithConfig("empty", `{"type":"image","width":10}`, empty.Bytes())
+	api.addTaskWithConfig("bomb", `{"type":"image","format":"png"}`, pngHeader(100_000, 100_000))
+	api.addTaskWithConfig("huge", `{"type":"image","width":100000,"height":100000}`, source)
+	api.addTaskWithConfig("stretched", `{"type":"image","width":40000}`, source)
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, imagehandler.New()),
+		worker.WithPollInterval(5*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(8)
+	stop()
+
+	img, err := jpeg.Decode(bytes.NewReader(api.results["jpeg"]))
+	if err != nil {
+		t.Fatalf("Expected a JPEG result: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 10 {
+		t.Errorf("Expected a 20x10 image keeping the aspect ratio, got %dx%d", b.Dx(), b.Dy())
+	}
+	if r, _, b, _ := img.At(2, 5).RGBA(); r>>8 < 200 || b>>8 > 60 {
+		t.Errorf("Expected the left side to stay red, got r=%d b=%d", r>>8, b>>8)
+	}
+
+	img, err = png.Decode(bytes.NewReader(api.results["png"]))
+	if err != nil {
+		t.Fatalf("Expected a PNG result: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 80 || b.Dy() != 10 {
+		t.Errorf("Expected an 80x10 image, got %dx%d", b.Dx(), b.Dy())
+	}
+	if status := api.lastStatus("png"); status.Progress == nil || *status.Progress != 100 {
+		t.Errorf("Expected the last progress update to be 100%%, got %+v", status)
+	}
+
+	if status := api.lastStatus("webp"); status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "unsupported output format") {
+		t.Errorf("Expected the webp task to be rejected, got %+v", status)
+	}
+	if status := api.lastStatus("broken"); status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "failed to read source image") {
+		t.Errorf("Expected the broken source to fail the task, got %+v", status)
+	}
+	if status := api.lastStatus("empty"); status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "is empty") {
+		t.Errorf("Expected the empty source to fail the task, got %+v", status)
+	}
+	if status := api.lastStatus("bomb"); status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "exceeds the limit of 50000000 pixels") {
+		t.Errorf("Expected the oversized source to be rejected by default, got %+v", status)
+	}
+	if status := api.lastStatus("huge"); status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "target image of 100000x100000 pixels exceeds") {
+		t.Errorf("Expected the oversized target to be rejected, got %+v", status)
+	}
+	if status := api.lastStatus("stretched"); status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "target image of 40000x20000 pixels exceeds") {
+		t.Errorf("Expected the target keeping the aspect ratio to be rejected, got %+v", status)
+	}
+}
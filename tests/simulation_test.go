@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/simulation"
+)
+
+func TestSimulation_Run(t *testing.T) {
+	report, err := simulation.Run(context.Background(), simulation.Config{
+		Workers:      20,
+		Tasks:        200,
+		TaskDuration: time.Millisecond,
+		Jitter:       time.Millisecond,
+		FailureRate:  0.2,
+		PollInterval: 5 * time.Millisecond,
+		Seed:         1,
+		Timeout:      30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Completed+report.Failed != 200 {
+		t.Errorf("Expected 200 finished tasks, got %d completed and %d failed", report.Completed, report.Failed)
+	}
+	if report.Failed < 10 || report.Failed > 80 {
+		t.Errorf("Expected about 20%% of simulated failures, got %d", report.Failed)
+	}
+	if report.DuplicateClaims != 0 || report.Errors != 0 {
+		t.Errorf("Expected no duplicate claims nor errors, got %+v", report)
+	}
+	if report.ClaimLatency.Count != 200 || report.QueueTime.Count != 200 || report.ClaimLatency.P95 < report.ClaimLatency.P50 {
+		t.Errorf("Expected the latency of the 200 claims, got %+v and %+v", report.ClaimLatency, report.QueueTime)
+	}
+	if report.Throughput <= 0 {
+		t.Errorf("Expected a positive throughput, got %f", report.Throughput)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded["durationSeconds"] == nil || decoded["claimLatency"] == nil {
+		t.Errorf("Expected a JSON report, got %s", buf.String())
+	}
+}
+
+func TestSimulation_DetectsDuplicateClaims(t *testing.T) {
+	// Tasks outlive their lease, so they are handed to a second worker while the first one still processes them.
+	server := simulation.NewServer(simulation.WithLeaseDuration(20 * time.Millisecond))
+	defer server.Close()
+
+	report, err := simulation.Run(context.Background(), simulation.Config{
+		BaseURL:      server.URL(),
+		Workers:      8,
+		Tasks:        4,
+		TaskDuration: 60 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+		Timeout:      200 * time.Millisecond,
+	})
+	if report == nil {
+		t.Fatalf("Expected a report, got error %v", err)
+	}
+	if report.DuplicateClaims == 0 || report.LeasesLost == 0 {
+		t.Errorf("Expected duplicate claims and lost leases, got %+v", report)
+	}
+}
+
+func TestSimulation_ServerErrors(t *testing.T) {
+	// Tasks whose hand back fails are queued again once their lease expires.
+	server := simulation.NewServer(simulation.WithErrorRate(0.1), simulation.WithLatency(time.Millisecond), simulation.WithLeaseDuration(100*time.Millisecond))
+	defer server.Close()
+
+	report, err := simulation.Run(context.Background(), simulation.Config{
+		BaseURL:      server.URL(),
+		Workers:      10,
+		Tasks:        100,
+		TaskRate:     1000,
+		PollInterval: 5 * time.Millisecond,
+		PollWait:     time.Second,
+		Timeout:      30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Completed != 100 {
+		t.Errorf("Expected every task to complete despite the errors, got %d", report.Completed)
+	}
+	if report.Errors == 0 || report.ErrorRate <= 0 || report.ErrorRate >= 0.5 {
+		t.Errorf("Expected about 10%% of failed requests, got %d of %d", report.Errors, report.Requests)
+	}
+	if counts := server.Counts(); counts[models.TaskStatusCompleted] != 100 {
+		t.Errorf("Expected the server to hold 100 completed tasks, got %v", counts)
+	}
+}
+
+func TestSimulation_RegistrationTokensAreSingleUse(t *testing.T) {
+	server := simulation.NewServer()
+	defer server.Close()
+
+	client := clients.NewClient(server.URL(), "")
+	if _, err := client.Workers.RegisterWorker(context.Background(), "token-1"); err != nil {
+		t.Fatalf("Expected the first registration to succeed, got %v", err)
+	}
+	if _, err := client.Workers.RegisterWorker(context.Background(), "token-1"); err == nil {
+		t.Error("Expected a reused registration token to be rejected")
+	}
+
+	_, err := simulation.Run(context.Background(), simulation.Config{
+		BaseURL:            server.URL(),
+		RegistrationTokens: []string{"token-2"},
+		Workers:            2,
+		Tasks:              1,
+	})
+	if err == nil {
+		t.Error("Expected a registration token to be required per worker")
+	}
+
+	report, err := simulation.Run(context.Background(), simulation.Config{
+		BaseURL:            server.URL(),
+		RegistrationTokens: []string{"token-2", "token-3"},
+		Workers:            2,
+		Tasks:              10,
+		PollInterval:       5 * time.Millisecond,
+		Timeout:            30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Completed != 10 || report.ErrorsByRequest["register"] != 0 {
+		t.Errorf("Expected each worker registered with its own token, got %+v", report)
+	}
+}
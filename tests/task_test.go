@@ -2,16 +2,25 @@ package tests
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
 	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
 	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
 )
 
 func setupTestServer(handler http.HandlerFunc) (*httptest.Server, *clients.Client) {
@@ -188,6 +197,74 @@ func TestTaskClient_UploadTaskResult(t *testing.T) {
 	}
 }
 
+func TestTaskClient_UploadTaskResults(t *testing.T) {
+	var parts []string
+	var metadata models.ResultMetadata
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/tasks/task1/result" || r.Method != http.MethodPost {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.ContentLength != -1 {
+			t.Errorf("Expected a streamed body, got a content length of %d", r.ContentLength)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("Failed to parse multipart form: %v", err)
+		}
+		for _, header := range r.MultipartForm.File["file"] {
+			f, _ := header.Open()
+			data, _ := io.ReadAll(f)
+			f.Close()
+			parts = append(parts, header.Filename+"="+string(data))
+		}
+		if err := json.Unmarshal([]byte(r.FormValue("metadata")), &metadata); err != nil {
+			t.Errorf("Failed to decode metadata: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"success":true,"message":"Result uploaded","data":{"id":"result1","filename":"video.mp4"}}`)
+	})
+	defer server.Close()
+
+	thumb := filepath.Join(t.TempDir(), "thumb.jpg")
+	if err := os.WriteFile(thumb, []byte("thumb"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := client.Tasks.(services.TaskWorkerService).UploadTaskResults(context.Background(), "task1", models.UploadTaskResultRequest{
+		Outputs: []models.ResultOutput{
+			{Filename: "video.mp4", Reader: strings.NewReader("video")},
+			{Path: thumb},
+		},
+		Metadata: &models.ResultMetadata{Duration: 1.5, Width: 640, Height: 360},
+	})
+	if err != nil {
+		t.Fatalf("UploadTaskResults failed: %v", err)
+	}
+	if file.ID != "result1" {
+		t.Errorf("Expected the created result file, got %+v", file)
+	}
+	if len(parts) != 2 || parts[0] != "video.mp4=video" || parts[1] != "thumb.jpg=thumb" {
+		t.Errorf("Expected the video then the thumbnail, got %v", parts)
+	}
+	sum := sha256.Sum256([]byte("video"))
+	if metadata.Checksum != hex.EncodeToString(sum[:]) || metadata.Width != 640 || metadata.Duration != 1.5 {
+		t.Errorf("Expected the metadata with the checksum of the video, got %+v", metadata)
+	}
+}
+
+func TestTaskClient_UploadTaskResults_MissingFile(t *testing.T) {
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	defer server.Close()
+
+	_, err := client.Tasks.(services.TaskWorkerService).UploadTaskResults(context.Background(), "task1", models.UploadTaskResultRequest{
+		Outputs: []models.ResultOutput{{Path: filepath.Join(t.TempDir(), "missing.mp4")}},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a missing output file")
+	}
+}
+
 func TestTaskClient_BuildAndExecute(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/v1/tasks" {
@@ -359,3 +436,180 @@ func TestTaskClient_CreateTask_FromPredefined_NotFound(t *testing.T) {
 		t.Errorf("Expected APIError with status 400, got %v", err)
 	}
 }
+
+func TestTaskClient_GetTaskLogs(t *testing.T) {
+	since := time.Date(2025, 9, 17, 10, 0, 0, 0, time.UTC)
+	server, mainClient := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/tasks" {
+			t.Errorf("Expected to request 'GET /v1/tasks', got %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusOK)
+		tasksData := []models.Task{
+			{ID: "other-task", Logs: []models.Log{{ID: "other", CreatedAt: since.Add(time.Minute)}}},
+			{ID: "task-with-logs", Logs: []models.Log{
+				{ID: "log2", TaskStatus: models.TaskStatusProcessing, CreatedAt: since.Add(2 * time.Minute)},
+				{ID: "log0", TaskStatus: models.TaskStatusPending, CreatedAt: since},
+				{ID: "log1", TaskStatus: models.TaskStatusProcessing, CreatedAt: since.Add(time.Minute)},
+			}},
+		}
+		var data interface{} = tasksData
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Success: true, Data: &data}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer server.Close()
+
+	logs, err := mainClient.Tasks.(services.TaskLogService).GetTaskLogs(context.Background(), "task-with-logs", since)
+	if err != nil {
+		t.Fatalf("GetTaskLogs failed: %v", err)
+	}
+	if len(logs) != 2 || logs[0].ID != "log1" || logs[1].ID != "log2" {
+		t.Errorf("Expected logs ordered [log1 log2], got %+v", logs)
+	}
+
+	if _, err := mainClient.Tasks.(services.TaskLogService).GetTaskLogs(context.Background(), "unknown-task", time.Time{}); !errors.Is(err, sdkerrors.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown task, got %v", err)
+	}
+}
+
+func TestTaskClient_FollowLogs(t *testing.T) {
+	start := time.Date(2025, 9, 17, 10, 0, 0, 0, time.UTC)
+	var calls atomic.Int32
+	server, mainClient := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		logsData := []models.Log{
+			{ID: "log1", TaskStatus: models.TaskStatusProcessing, Message: "started", CreatedAt: start},
+		}
+		if calls.Add(1) > 1 {
+			logsData = append(logsData, models.Log{ID: "log2", TaskStatus: models.TaskStatusCompleted, Message: "done", CreatedAt: start.Add(time.Minute)})
+		}
+		w.WriteHeader(http.StatusOK)
+		status := models.TaskStatusProcessing
+		if calls.Load() > 1 {
+			status = models.TaskStatusCompleted
+		}
+		var data interface{} = []models.Task{{ID: "followed-task", Status: status, Logs: logsData}}
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Success: true, Data: &data}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer server.Close()
+
+	var messages []string
+	for log, err := range mainClient.Tasks.(services.TaskLogService).FollowLogs(context.Background(), "followed-task", time.Millisecond) {
+		if err != nil {
+			t.Fatalf("FollowLogs failed: %v", err)
+		}
+		messages = append(messages, log.Message)
+	}
+
+	if len(messages) != 2 || messages[0] != "started" || messages[1] != "done" {
+		t.Errorf("Expected messages [started done], got %v", messages)
+	}
+}
+
+func TestTaskClient_FollowLogs_SameTimestamp(t *testing.T) {
+	start := time.Date(2025, 9, 17, 10, 0, 0, 0, time.UTC)
+	var calls atomic.Int32
+	server, mainClient := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		// The second log shares the timestamp of the first one, and the task ends without a terminal log.
+		task := models.Task{ID: "followed-task", Status: models.TaskStatusProcessing, Logs: []models.Log{
+			{ID: "log1", TaskStatus: models.TaskStatusProcessing, Message: "started", CreatedAt: start},
+		}}
+		if calls.Add(1) > 1 {
+			task.Status = models.TaskStatusCompleted
+			task.Logs = append(task.Logs, models.Log{ID: "log2", TaskStatus: models.TaskStatusProcessing, Message: "encoding", CreatedAt: start})
+		}
+		w.WriteHeader(http.StatusOK)
+		var data interface{} = []models.Task{task}
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Success: true, Data: &data}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var messages []string
+	for log, err := range mainClient.Tasks.(services.TaskLogService).FollowLogs(ctx, "followed-task", time.Millisecond) {
+		if err != nil {
+			t.Fatalf("FollowLogs failed: %v", err)
+		}
+		messages = append(messages, log.Message)
+	}
+	if len(messages) != 2 || messages[1] != "encoding" {
+		t.Errorf("Expected messages [started encoding], got %v", messages)
+	}
+}
+
+func TestTaskClient_GetPendingTask_Empty(t *testing.T) {
+	server, mainClient := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(models.APIErrorResponse{Success: false, Message: "No pending task"})
+	})
+	defer server.Close()
+
+	task, err := mainClient.Tasks.GetPendingTask(context.Background())
+	if !errors.Is(err, sdkerrors.ErrNoPendingTask) {
+		t.Errorf("Expected ErrNoPendingTask, got %v", err)
+	}
+	if task != nil {
+		t.Errorf("Expected no task, got %+v", task)
+	}
+}
+
+func TestTaskClient_GetPendingTaskWithOptions(t *testing.T) {
+	server, mainClient := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/tasks/pending" {
+			t.Errorf("Expected to request '/v1/tasks/pending', got %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("wait"); got != "25" {
+			t.Errorf("Expected wait clamped to '25', got '%s'", got)
+		}
+		w.WriteHeader(http.StatusOK)
+		var data interface{} = models.Task{ID: "pending-task-id"}
+		if err := json.NewEncoder(w).Encode(models.APIResponse{Success: true, Data: &data}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer server.Close()
+
+	task, err := mainClient.Tasks.(services.TaskWorkerService).GetPendingTaskWithOptions(context.Background(), models.PendingTaskOptions{Wait: time.Minute})
+	if err != nil {
+		t.Fatalf("GetPendingTaskWithOptions failed: %v", err)
+	}
+
+	if task.ID != "pending-task-id" {
+		t.Errorf("Expected task ID 'pending-task-id', got '%s'", task.ID)
+	}
+}
+
+func TestTaskClient_GetPendingTaskWithOptions_Unsupported(t *testing.T) {
+	var queries []string
+	server, mainClient := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		if r.URL.RawQuery != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.APIErrorResponse{Success: false, Message: "Unknown query parameter"})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		var data interface{} = models.Task{ID: "pending-task-id"}
+		json.NewEncoder(w).Encode(models.APIResponse{Success: true, Data: &data})
+	})
+	defer server.Close()
+
+	opts := models.PendingTaskOptions{Wait: time.Second, Types: []models.WorkerType{models.WorkerTypeImage}}
+	for range 2 {
+		task, err := mainClient.Tasks.(services.TaskWorkerService).GetPendingTaskWithOptions(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("GetPendingTaskWithOptions failed: %v", err)
+		}
+		if task.ID != "pending-task-id" {
+			t.Errorf("Expected task ID 'pending-task-id', got '%s'", task.ID)
+		}
+	}
+	// The first poll is retried without its options, which later polls no longer send.
+	if len(queries) != 3 || queries[0] == "" || queries[1] != "" || queries[2] != "" {
+		t.Errorf("Expected a single poll with options, got %q", queries)
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// countingHandler counts its invocations and returns the source unchanged.
+type countingHandler struct {
+	calls atomic.Int32
+}
+
+func (h *countingHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	h.calls.Add(1)
+	return upperHandler{}.Handle(ctx, job)
+}
+
+func TestRunner_ReusesCachedResults(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTaskWithConfig("task1", `{"type":"image","format":"png","quality":80}`, []byte("same"))
+	api.addTaskWithConfig("task2", `{"quality":80,"format":"png","type":"image"}`, []byte("same"))
+	api.addTaskWithConfig("task3", `{"type":"image","format":"jpeg"}`, []byte("same"))
+	api.addTaskWithConfig("task4", `{"type":"image","format":"png","quality":80}`, []byte("other"))
+
+	h := &countingHandler{}
+	cacheDir := t.TempDir()
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithResultCache(cacheDir, 1<<20),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(4)
+	stop()
+
+	if calls := h.calls.Load(); calls != 3 {
+		t.Errorf("Expected 3 handler calls, got %d", calls)
+	}
+	if got := string(api.results["task2"]); got != "SAME" {
+		t.Errorf("Expected the cached result 'SAME', got '%s'", got)
+	}
+	api.mu.Lock()
+	downloads := len(api.downloads)
+	api.mu.Unlock()
+	if downloads != 3 {
+		t.Errorf("Expected the source of the cached task not to be downloaded, got %d downloads", downloads)
+	}
+}
+
+func TestRunner_EvictsLeastRecentlyUsedResults(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	for _, id := range []string{"a", "b", "c"} {
+		api.addTask("first-"+id, models.WorkerTypeImage, []byte(id+id+id+id))
+	}
+	api.addTask("again-a", models.WorkerTypeImage, []byte("aaaa"))
+
+	h := &countingHandler{}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithResultCache(t.TempDir(), 8), // Room for two results
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(4)
+	stop()
+
+	if calls := h.calls.Load(); calls != 4 {
+		t.Errorf("Expected the evicted result to be produced again, got %d handler calls", calls)
+	}
+}
+
+func TestRunner_CachedResultNeedsNoDiskSpace(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	cacheDir := t.TempDir()
+	newRunner := func(quota int64) *worker.Runner {
+		return worker.NewRunner(api.client("test_token"),
+			worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+			worker.WithPollInterval(5*time.Millisecond),
+			worker.WithWorkDir(t.TempDir()),
+			worker.WithDiskQuota(quota),
+			worker.WithResultCache(cacheDir, 1<<20),
+		)
+	}
+
+	api.addTask("task1", models.WorkerTypeImage, []byte("same"))
+	stop := runWorker(t, newRunner(1<<20))
+	api.waitDone(1)
+	stop()
+
+	// The source would not fit in the quota, but its result is cached.
+	api.addTask("task2", models.WorkerTypeImage, []byte("same"))
+	stop = runWorker(t, newRunner(1))
+	api.waitDone(1)
+	stop()
+
+	if got := string(api.results["task2"]); got != "SAME" {
+		t.Errorf("Expected the cached result 'SAME', got '%s' (status %+v)", got, api.lastStatus("task2"))
+	}
+}
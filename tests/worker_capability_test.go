@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// pngOnlyHandler only converts images to PNG.
+type pngOnlyHandler struct {
+	upperHandler
+}
+
+func (pngOnlyHandler) ValidateConfig(task *models.Task) error {
+	var config models.ImageConversionConfig
+	if err := task.DecodeConfig(&config); err != nil {
+		return err
+	}
+	if config.Format != "png" {
+		return errors.New("only png output is supported")
+	}
+	return nil
+}
+
+func TestConversionConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config interface{ Validate() error }
+		valid  bool
+	}{
+		{"image", models.NewImageConfig().WithFormat("png").WithQuality(80), true},
+		{"image quality", models.NewImageConfig().WithQuality(500), false},
+		{"image format", models.NewImageConfig().WithFormat("bmp"), false},
+		{"video", models.NewVideoConfig().WithCodec("vp9").WithResolution("1920x1080"), true},
+		{"video resolution", models.NewVideoConfig().WithResolution("1080p"), false},
+		{"audio", models.NewAudioConfig().WithCodec("opus"), true},
+		{"audio type", &models.AudioConversionConfig{Type: "video"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestRunner_RejectsInvalidConfig(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTaskWithConfig("task1", `{"type":"image","quality":500}`, []byte("a"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	status := api.lastStatus("task1")
+	if status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "invalid quality 500") {
+		t.Errorf("Expected task to fail with the invalid field, got %+v", status)
+	}
+}
+
+func TestRunner_HandsBackUnsupportedConfig(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTaskWithConfig("task1", `{"type":"image","format":"webp"}`, []byte("a"))
+	api.addTaskWithConfig("task2", `{"type":"image","format":"png"}`, []byte("b"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, pngOnlyHandler{}),
+		worker.WithMiddleware(worker.Logging(slog.New(slog.DiscardHandler))),
+		worker.WithRejectStatus(models.TaskStatusPending),
+		worker.WithHeartbeatInterval(time.Hour),
+		worker.WithPollInterval(5*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	stop()
+
+	status := api.lastStatus("task1")
+	if status.Status != models.TaskStatusPending || !strings.Contains(status.StatusMessage, "only png output is supported") {
+		t.Errorf("Expected the unsupported task to be handed back with its reason, got %+v", status)
+	}
+	if got := string(api.results["task2"]); got != "B" {
+		t.Errorf("Expected result 'B', got '%s'", got)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.heartbeats) == 0 || !slices.Equal(api.heartbeats[0].Capabilities, []models.WorkerType{models.WorkerTypeImage}) {
+		t.Errorf("Expected heartbeats to advertise the capabilities, got %+v", api.heartbeats)
+	}
+}
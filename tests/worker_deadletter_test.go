@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// poisonHandler fails every task like a command crashing on its input.
+type poisonHandler struct{}
+
+func (poisonHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	return nil, &worker.ExecError{Message: "cannot decode source", Stderr: "decoder: invalid header"}
+}
+
+func TestRunner_DeadLettersAfterThreshold(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTaskWithConfig("task1", `{"type":"image","format":"png"}`, []byte("hello"))
+	// Two workers already failed the task, one reporting it as failed and the other handing it back.
+	api.statuses["task1"] = []models.UpdateTaskStatusRequest{
+		{Status: models.TaskStatusFailed, StatusMessage: "crashed"},
+		{Status: models.TaskStatusPending, StatusMessage: "processing failed: cannot decode source"},
+	}
+
+	diagDir := t.TempDir()
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, poisonHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithVersion("1.2.3"),
+		worker.WithDeadLetter(3),
+		worker.WithDiagnosticsSink(worker.DiagnosticsDir(diagDir)),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2) // The diagnostics upload, then the failure
+	stop()
+
+	status := api.lastStatus("task1")
+	if status.Status != models.TaskStatusFailed || !strings.HasPrefix(status.StatusMessage, "dead-lettered after 3 failures") ||
+		!strings.Contains(status.StatusMessage, "decoder: invalid header") {
+		t.Errorf("Expected the task dead-lettered with a summary, got %+v", status)
+	}
+	stored, err := os.ReadFile(filepath.Join(diagDir, worker.DefaultInstance, "task1.json"))
+	if err != nil {
+		t.Fatalf("Expected the diagnostics stored: %v", err)
+	}
+	data := api.results["task1"]
+	if string(data) != string(stored) {
+		t.Errorf("Expected the diagnostics uploaded as the result file, got %q", data)
+	}
+	var diag worker.Diagnostics
+	if err := json.Unmarshal(data, &diag); err != nil {
+		t.Fatalf("Failed to decode diagnostics %q: %v", data, err)
+	}
+	if diag.TaskID != "task1" || diag.Failures != 3 || diag.Stderr != "decoder: invalid header" || diag.Version != "1.2.3" {
+		t.Errorf("Unexpected diagnostics: %+v", diag)
+	}
+	if diag.Source == nil || diag.Source.ID != "src-task1" {
+		t.Errorf("Expected the source metadata in the diagnostics, got %+v", diag.Source)
+	}
+	if config, _ := json.Marshal(diag.Config); !strings.Contains(string(config), "png") {
+		t.Errorf("Expected the task configuration in the diagnostics, got %s", config)
+	}
+}
+
+func TestRunner_RetriesFailedTasks(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	newRunner := func() *worker.Runner {
+		return worker.NewRunner(api.client("test_token"),
+			worker.WithHandler(models.WorkerTypeImage, poisonHandler{}),
+			worker.WithPollInterval(5*time.Millisecond),
+			worker.WithWorkDir(t.TempDir()),
+			worker.WithDeadLetter(2),
+		)
+	}
+
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+	stop := runWorker(t, newRunner())
+	api.waitDone(1)
+	stop()
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusPending || !strings.HasPrefix(status.StatusMessage, "processing failed: ") {
+		t.Errorf("Expected a first failure handed back for a retry, got %+v", status)
+	}
+
+	// Another worker counts the failure from the status history of the task.
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+	stop = runWorker(t, newRunner())
+	api.waitDone(1)
+	stop()
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusFailed || !strings.HasPrefix(status.StatusMessage, "dead-lettered after 2 failures") {
+		t.Errorf("Expected the task dead-lettered, got %+v", status)
+	}
+}
+
+func TestRunner_CountsLocalFailures(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.noLogs = true
+	dir := t.TempDir()
+	newRunner := func() *worker.Runner {
+		return worker.NewRunner(api.client("test_token"),
+			worker.WithHandler(models.WorkerTypeImage, poisonHandler{}),
+			worker.WithPollInterval(5*time.Millisecond),
+			worker.WithWorkDir(dir),
+			worker.WithDeadLetter(2),
+		)
+	}
+
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+	stop := runWorker(t, newRunner())
+	api.waitDone(1)
+	stop()
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusPending {
+		t.Errorf("Expected a first failure to be retried, got %+v", status)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "failures.json")); err != nil {
+		t.Errorf("Expected the failure recorded: %v", err)
+	}
+
+	// The task is retried after a restart, the local record standing in for the missing history.
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+	stop = runWorker(t, newRunner())
+	api.waitDone(2)
+	stop()
+	if status := api.lastStatus("task1"); !strings.HasPrefix(status.StatusMessage, "dead-lettered after 2 failures") {
+		t.Errorf("Expected the task dead-lettered, got %+v", status)
+	}
+}
+
+func TestRunner_DeadLetterDisabledByDefault(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+	api.statuses["task1"] = []models.UpdateTaskStatusRequest{{Status: models.TaskStatusFailed}, {Status: models.TaskStatusFailed}}
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, poisonHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusFailed || strings.HasPrefix(status.StatusMessage, "dead-lettered") {
+		t.Errorf("Expected the task failed without WithDeadLetter, got %+v", status)
+	}
+}
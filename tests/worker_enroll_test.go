@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func TestEnroll_RegistersOnceThenRefreshes(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	path := filepath.Join(t.TempDir(), "worker", "credentials.json")
+
+	client := api.client("")
+	creds, err := worker.Enroll(context.Background(), client, path, "registration-token")
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+	if creds.Token != "worker_jwt_token" || client.GetToken() != "worker_jwt_token" {
+		t.Errorf("Expected the registered token to be used, got %+v", creds)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected a credentials file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("Expected credentials to be readable by the owner only, got %v", perm)
+	}
+
+	client = api.client("")
+	creds, err = worker.Enroll(context.Background(), client, path, "registration-token")
+	if err != nil {
+		t.Fatalf("Enroll failed on restart: %v", err)
+	}
+	if creds.Token != "worker_jwt_token_1" || creds.RefreshToken != "worker_refresh_token_1" {
+		t.Errorf("Expected refreshed credentials, got %+v", creds)
+	}
+	if api.registrations != 1 || api.refreshes != 1 {
+		t.Errorf("Expected 1 registration and 1 refresh, got %d and %d", api.registrations, api.refreshes)
+	}
+	saved, err := worker.LoadCredentials(path)
+	if err != nil || saved.RefreshToken != "worker_refresh_token_1" {
+		t.Errorf("Expected the refreshed credentials to be saved, got %+v (%v)", saved, err)
+	}
+}
+
+func TestEnroll_ReusesTokenWithoutRefreshToken(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.noRefresh = true
+	path := filepath.Join(t.TempDir(), "credentials.json")
+
+	for i := range 2 {
+		client := api.client("")
+		creds, err := worker.Enroll(context.Background(), client, path, "registration-token")
+		if err != nil {
+			t.Fatalf("Enroll %d failed: %v", i+1, err)
+		}
+		if creds.Token != "worker_jwt_token" || client.GetToken() != "worker_jwt_token" {
+			t.Errorf("Expected the registered token to be used, got %+v", creds)
+		}
+	}
+	if api.registrations != 1 || api.refreshes != 0 {
+		t.Errorf("Expected 1 registration and no refresh, got %d and %d", api.registrations, api.refreshes)
+	}
+}
+
+func TestEnroll_KeepsRegistrationTokenWhenRefreshFails(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := worker.SaveCredentials(path, &worker.Credentials{Token: "old", RefreshToken: "revoked"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := worker.Enroll(context.Background(), api.client(""), path, "registration-token")
+	if !errors.Is(err, sdkerrors.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if api.registrations != 0 {
+		t.Errorf("Expected the registration token not to be used, got %d registrations", api.registrations)
+	}
+}
+
+func TestRunner_CredentialsFile(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+
+	for _, id := range []string{"task1", "task2"} {
+		api.addTask(id, models.WorkerTypeImage, []byte("hello"))
+		runner := worker.NewRunner(api.client(""),
+			worker.WithRegistrationToken("registration-token"),
+			worker.WithCredentialsFile(path),
+			worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+			worker.WithPollInterval(5*time.Millisecond),
+		)
+		stop := runWorker(t, runner)
+		api.waitDone(1)
+		stop()
+	}
+
+	if api.registrations != 1 || api.refreshes != 1 {
+		t.Errorf("Expected 1 registration and 1 refresh over two starts, got %d and %d", api.registrations, api.refreshes)
+	}
+}
@@ -0,0 +1,216 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+type recordedProgress struct {
+	mu      sync.Mutex
+	updates []string
+}
+
+func (p *recordedProgress) Report(percent float64, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updates = append(p.updates, message)
+}
+
+func execJob(t *testing.T, config interface{}) *worker.Job {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("external handler tests rely on /bin/sh")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	if err := os.WriteFile(source, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &worker.Job{
+		Task:       models.Task{ID: "task1", Config: config},
+		Type:       models.WorkerTypeImage,
+		Source:     &models.File{Filename: "source.txt"},
+		SourcePath: source,
+		Dir:        dir,
+		Progress:   &recordedProgress{},
+	}
+}
+
+// readOutput returns the content of a result output, held in memory or on disk.
+func readOutput(t *testing.T, data []byte, path string) string {
+	t.Helper()
+	if path == "" {
+		return string(data)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	return string(data)
+}
+
+func TestExecHandler_Result(t *testing.T) {
+	job := execJob(t, `{"type":"image","format":"png"}`)
+	script := `
+input=$(cat)
+echo "not json"
+echo '{"type":"progress","percent":50,"message":"halfway"}'
+echo "$input" > request.json
+echo '{"type":"result","path":"request.json","filename":"out.json"}'
+`
+	result, err := worker.NewExecHandler("sh", "-c", script).Handle(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if result.Filename != "out.json" {
+		t.Errorf("Expected filename 'out.json', got '%s'", result.Filename)
+	}
+	request := readOutput(t, result.Data, result.Path)
+	for _, want := range []string{`"taskId":"task1"`, `"format":"png"`, `"sourcePath":"` + job.SourcePath + `"`} {
+		if !strings.Contains(request, want) {
+			t.Errorf("Expected request to contain %s, got %s", want, request)
+		}
+	}
+	if updates := job.Progress.(*recordedProgress).updates; len(updates) != 1 || updates[0] != "halfway" {
+		t.Errorf("Expected one progress update, got %v", updates)
+	}
+}
+
+func TestExecHandler_Attachments(t *testing.T) {
+	job := execJob(t, nil)
+	script := `
+echo video > video.mp4
+echo thumb > thumb.jpg
+echo '{"type":"result","path":"video.mp4","attachments":["thumb.jpg"],"metadata":{"duration":12.5,"width":640,"height":360}}'
+`
+	result, err := worker.NewExecHandler("sh", "-c", script).Handle(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if result.Filename != "video.mp4" || result.Data != nil || readOutput(t, nil, result.Path) != "video\n" {
+		t.Errorf("Expected the video to be streamed from disk, got %+v", result)
+	}
+	if len(result.Attachments) != 1 || result.Attachments[0].Filename != "thumb.jpg" || readOutput(t, nil, result.Attachments[0].Path) != "thumb\n" {
+		t.Errorf("Expected the thumbnail as an attachment, got %+v", result.Attachments)
+	}
+	if m := result.Metadata; m == nil || m.Duration != 12.5 || m.Width != 640 || m.Height != 360 {
+		t.Errorf("Expected the reported metadata, got %+v", m)
+	}
+}
+
+func TestExecHandler_Failure(t *testing.T) {
+	job := execJob(t, nil)
+	script := `
+echo "codec not found" >&2
+echo '{"type":"error","message":"unsupported input"}'
+exit 3
+`
+	_, err := worker.NewExecHandler("sh", "-c", script).Handle(context.Background(), job)
+	var execErr *worker.ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("Expected an ExecError, got %v", err)
+	}
+	if execErr.ExitCode() != 3 || execErr.Message != "unsupported input" || !strings.Contains(err.Error(), "codec not found") {
+		t.Errorf("Expected exit code, message and stderr in the error, got %v", err)
+	}
+}
+
+func TestExecHandler_KillsProcessGroupOnTimeout(t *testing.T) {
+	job := execJob(t, nil)
+	h := worker.NewExecHandler("sh", "-c", "sleep 30 & wait")
+	h.Timeout = 100 * time.Millisecond
+
+	started := time.Now()
+	_, err := h.Handle(context.Background(), job)
+	if !errors.Is(err, worker.ErrTaskTimeout) {
+		t.Errorf("Expected ErrTaskTimeout, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("Expected the process group to be killed promptly, took %s", elapsed)
+	}
+}
+
+func TestExecHandler_SkipsOversizedLines(t *testing.T) {
+	job := execJob(t, nil)
+	script := `
+head -c 2000000 /dev/zero | tr '\0' 'x'
+echo
+echo '{"type":"progress","percent":50,"message":"after a long line"}'
+echo done > out.txt
+echo '{"type":"result","path":"out.txt"}'
+`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := worker.NewExecHandler("sh", "-c", script).Handle(ctx, job)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if readOutput(t, result.Data, result.Path) != "done\n" {
+		t.Errorf("Expected the result reported after the long line, got %+v", result)
+	}
+	if updates := job.Progress.(*recordedProgress).updates; len(updates) != 1 {
+		t.Errorf("Expected the progress reported after the long line, got %v", updates)
+	}
+}
+
+func TestExecHandler_BackgroundProcessHoldingOutput(t *testing.T) {
+	job := execJob(t, nil)
+	script := `
+sleep 10 &
+echo done > out.txt
+echo '{"type":"result","path":"out.txt"}'
+`
+	started := time.Now()
+	result, err := worker.NewExecHandler("sh", "-c", script).Handle(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if readOutput(t, result.Data, result.Path) != "done\n" {
+		t.Errorf("Expected the result of the command, got %+v", result)
+	}
+	if elapsed := time.Since(started); elapsed > 15*time.Second {
+		t.Errorf("Expected the handler not to wait for the background process, took %v", elapsed)
+	}
+}
+
+func TestExecHandler_RejectsOutputsOutsideOutputDir(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"absolute path": `echo '{"type":"result","path":"` + outside + `"}'`,
+		"parent path":   `echo '{"type":"result","path":"../` + filepath.Base(outside) + `"}'`,
+		"symlink":       `ln -s ` + outside + ` link.txt; echo '{"type":"result","path":"link.txt"}'`,
+		"directory":     `mkdir out; echo '{"type":"result","path":"out"}'`,
+		"attachment":    `echo done > out.txt; echo '{"type":"result","path":"out.txt","attachments":["` + outside + `"]}'`,
+	}
+	for name, script := range tests {
+		t.Run(name, func(t *testing.T) {
+			job := execJob(t, nil)
+			if name == "parent path" {
+				// Place the file next to the output directory.
+				outside := filepath.Join(filepath.Dir(job.Dir), filepath.Base(outside))
+				if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := worker.NewExecHandler("sh", "-c", script).Handle(context.Background(), job); err == nil {
+				t.Error("Expected the output to be rejected")
+			}
+		})
+	}
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "secret" {
+		t.Errorf("Expected the file outside the output directory to be untouched, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func TestRunner_SendsHeartbeats(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	h := &blockingHandler{started: make(chan struct{}), delay: 100 * time.Millisecond, cause: make(chan error, 1)}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithHeartbeatInterval(10*time.Millisecond),
+		worker.WithVersion("1.2.3"),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	busy := slices.IndexFunc(api.heartbeats, func(hb models.HeartbeatRequest) bool {
+		return hb.Status == models.WorkerStatusBusy && slices.Equal(hb.TaskIDs, []string{"task1"}) && hb.Load == 1
+	})
+	if busy < 0 {
+		t.Errorf("Expected a busy heartbeat reporting task1, got %+v", api.heartbeats)
+	}
+	last := api.heartbeats[len(api.heartbeats)-1]
+	if last.Status != models.WorkerStatusOffline || last.Version != "1.2.3" {
+		t.Errorf("Expected a final offline heartbeat with version 1.2.3, got %+v", last)
+	}
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// orderHandler records the source of the tasks it handles, in order.
+type orderHandler struct {
+	mu      sync.Mutex
+	sources []string
+}
+
+func (h *orderHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	data, err := os.ReadFile(job.SourcePath)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	h.sources = append(h.sources, string(data))
+	h.mu.Unlock()
+	return &worker.Result{Filename: "result.txt", Data: data}, nil
+}
+
+func (h *orderHandler) order() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.sources)
+}
+
+// runInstances queues the tasks of each API, processes them one at a time and returns the order
+// in which their sources were handled.
+func runInstances(t *testing.T, staging, production *fakeWorkerAPI, opts ...worker.Option) []string {
+	t.Helper()
+	for i := 1; i <= 3; i++ {
+		id := string(rune('0' + i))
+		staging.addTask("task"+id, models.WorkerTypeImage, []byte("staging"+id))
+		production.addTask("task"+id, models.WorkerTypeImage, []byte("production"+id))
+	}
+	handler := &orderHandler{}
+	opts = append([]worker.Option{
+		worker.WithHandler(models.WorkerTypeImage, handler),
+		worker.WithPollInterval(5 * time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+	}, opts...)
+	stop := runWorker(t, worker.NewRunner(nil, opts...))
+	staging.waitDone(3)
+	production.waitDone(3)
+	stop()
+	return handler.order()
+}
+
+func TestRunner_InstancePriority(t *testing.T) {
+	staging, production := newFakeWorkerAPI(t), newFakeWorkerAPI(t)
+	order := runInstances(t, staging, production,
+		worker.WithInstance(worker.Instance{Name: "staging", Client: staging.client("staging_token")}),
+		worker.WithInstance(worker.Instance{Name: "production", Client: production.client("production_token"), Priority: 1}),
+	)
+	want := []string{"production1", "production2", "production3", "staging1", "staging2", "staging3"}
+	if !slices.Equal(order, want) {
+		t.Errorf("Expected %v, got %v", want, order)
+	}
+}
+
+func TestRunner_InstanceRoundRobin(t *testing.T) {
+	staging, production := newFakeWorkerAPI(t), newFakeWorkerAPI(t)
+	order := runInstances(t, staging, production,
+		worker.WithInstance(worker.Instance{Name: "staging", Client: staging.client("staging_token")}),
+		worker.WithInstance(worker.Instance{Name: "production", Client: production.client("production_token")}),
+		worker.WithPolicy(worker.PolicyRoundRobin),
+	)
+	want := []string{"staging1", "production1", "staging2", "production2", "staging3", "production3"}
+	if !slices.Equal(order, want) {
+		t.Errorf("Expected %v, got %v", want, order)
+	}
+}
+
+func TestRunner_InstanceWeighted(t *testing.T) {
+	staging, production := newFakeWorkerAPI(t), newFakeWorkerAPI(t)
+	order := runInstances(t, staging, production,
+		worker.WithInstance(worker.Instance{Name: "staging", Client: staging.client("staging_token")}),
+		worker.WithInstance(worker.Instance{Name: "production", Client: production.client("production_token"), Weight: 2}),
+		worker.WithPolicy(worker.PolicyWeighted),
+	)
+	want := []string{"production1", "staging1", "production2", "production3", "staging2", "staging3"}
+	if !slices.Equal(order, want) {
+		t.Errorf("Expected %v, got %v", want, order)
+	}
+}
+
+func TestRunner_InstancesAreSeparate(t *testing.T) {
+	staging, production := newFakeWorkerAPI(t), newFakeWorkerAPI(t)
+	staging.addTask("task1", models.WorkerTypeImage, []byte("staging"))
+	production.addTask("task1", models.WorkerTypeImage, []byte("production"))
+	production.addTask("task2", models.WorkerTypeVideo, []byte("production"))
+	production.ignoreTypes = true
+
+	dir := t.TempDir()
+	runner := worker.NewRunner(staging.client(""),
+		worker.WithRegistrationToken("staging_registration"),
+		worker.WithCredentialsFile(filepath.Join(dir, "staging.json")),
+		worker.WithInstance(worker.Instance{
+			Name:              "production",
+			Client:            production.client(""),
+			RegistrationToken: "production_registration",
+			CredentialsFile:   filepath.Join(dir, "production.json"),
+		}),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithHeartbeatInterval(10*time.Millisecond),
+		worker.WithWorkDir(filepath.Join(dir, "work")),
+	)
+	server := httptest.NewServer(runner.MetricsHandler())
+	defer server.Close()
+
+	stop := runWorker(t, runner)
+	staging.waitDone(1)
+	production.waitDone(2)
+	stop()
+
+	if string(staging.results["task1"]) != "STAGING" || string(production.results["task1"]) != "PRODUCTION" {
+		t.Errorf("Expected each result uploaded to its instance, got %q and %q", staging.results["task1"], production.results["task1"])
+	}
+	if status := production.lastStatus("task2"); status.Status != models.TaskStatusFailed {
+		t.Errorf("Expected the unhandled task failed on its instance, got %+v", status)
+	}
+	if len(staging.statuses["task2"]) != 0 {
+		t.Errorf("Expected no status reported to the other instance, got %+v", staging.statuses["task2"])
+	}
+	if staging.registrations != 1 || production.registrations != 1 {
+		t.Errorf("Expected one registration per instance, got %d and %d", staging.registrations, production.registrations)
+	}
+	for _, name := range []string{"staging.json", "production.json"} {
+		if _, err := worker.LoadCredentials(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected credentials saved in %s: %v", name, err)
+		}
+	}
+	if len(staging.heartbeats) == 0 || len(production.heartbeats) == 0 {
+		t.Errorf("Expected heartbeats sent to both instances, got %d and %d", len(staging.heartbeats), len(production.heartbeats))
+	}
+
+	_, body := get(t, server.URL+"/metrics")
+	for _, want := range []string{
+		`qalpuch_worker_tasks_claimed_total{type="image"} 2`,
+		`qalpuch_worker_instance_tasks_claimed_total{instance="default",type="image"} 1`,
+		`qalpuch_worker_instance_tasks_claimed_total{instance="production",type="image"} 1`,
+		`qalpuch_worker_instance_tasks_failed_total{instance="production",type="video"} 1`,
+		`qalpuch_worker_instance_poll_duration_seconds_count{instance="production"}`,
+		`qalpuch_worker_instance_ready{instance="default"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestRunner_RejectsDuplicateInstances(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithInstance(worker.Instance{Name: worker.DefaultInstance, Client: api.client("test_token")}),
+	)
+	if err := runner.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "duplicate instance") {
+		t.Errorf("Expected a duplicate instance error, got %v", err)
+	}
+}
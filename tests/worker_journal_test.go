@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func TestRunner_RecoversJournal(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+
+	dir := t.TempDir()
+	result := filepath.Join(dir, "results", "task2")
+	if err := os.MkdirAll(filepath.Dir(result), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(result, []byte("DONE"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	journal := `[
+		{"taskId":"task1","instance":"default","type":"image","phase":"processing","claimedAt":"2026-01-01T00:00:00Z"},
+		{"taskId":"task2","instance":"default","type":"image","phase":"uploading","claimedAt":"2026-01-01T00:00:00Z","resultPath":"` + result + `","resultName":"out.txt"}
+	]`
+	if err := os.WriteFile(filepath.Join(dir, "journal.json"), []byte(journal), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(dir),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	stop()
+
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusFailed || status.StatusMessage != "worker restarted" {
+		t.Errorf("Expected the interrupted task to be reported as failed, got %+v", status)
+	}
+	if got := string(api.results["task2"]); got != "DONE" {
+		t.Errorf("Expected the saved result to be uploaded, got '%s'", got)
+	}
+	if _, err := os.Stat(result); !os.IsNotExist(err) {
+		t.Errorf("Expected the saved result to be removed, got %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "journal.json"))
+	if err != nil || string(data) != "[]" {
+		t.Errorf("Expected an empty journal, got %q (%v)", data, err)
+	}
+}
+
+func TestRunner_ClearsJournalAfterTask(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+
+	dir := t.TempDir()
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(dir),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	data, err := os.ReadFile(filepath.Join(dir, "journal.json"))
+	if err != nil || string(data) != "[]" {
+		t.Errorf("Expected an empty journal, got %q (%v)", data, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "results")); len(entries) != 0 {
+		t.Errorf("Expected no saved result, got %v", entries)
+	}
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	sdkerrors "github.com/Q300Z/go_sdk_qalpuch_api/pkg/errors"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/services"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func TestTaskClient_RenewTaskLease_Conflict(t *testing.T) {
+	server, mainClient := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/tasks/task1/lease" {
+			t.Errorf("Expected to request '/v1/tasks/task1/lease', got %s", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(models.APIErrorResponse{Success: false, Message: "Task is assigned to another worker"})
+	})
+	defer server.Close()
+
+	_, err := mainClient.Tasks.(services.TaskWorkerService).RenewTaskLease(context.Background(), "task1")
+	if !errors.Is(err, sdkerrors.ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost, got %v", err)
+	}
+}
+
+func TestRunner_CancelsHandlerWhenLeaseIsLost(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	h := &blockingHandler{started: make(chan struct{}), delay: time.Hour, cause: make(chan error, 1)}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithLeaseRenewal(10*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	<-h.started
+	api.mu.Lock()
+	api.lostLeases["task1"] = true
+	api.mu.Unlock()
+
+	select {
+	case cause := <-h.cause:
+		if !errors.Is(cause, sdkerrors.ErrLeaseLost) {
+			t.Errorf("Expected handler to be cancelled with ErrLeaseLost, got %v", cause)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Handler was not cancelled after losing the lease")
+	}
+	stop()
+
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusProcessing {
+		t.Errorf("Expected no status to be reported after losing the lease, got %+v", status)
+	}
+}
+
+func TestRunner_StopsLeaseRenewalWhenUnsupported(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.noLease = true
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, &blockingHandler{started: make(chan struct{}), delay: 100 * time.Millisecond}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithLeaseRenewal(10*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	if got := string(api.results["task1"]); got != "done" {
+		t.Errorf("Expected the task to complete without lease renewal, got %q", got)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if renewals := api.renewals["task1"]; renewals != 1 {
+		t.Errorf("Expected renewal to stop after the first rejection, got %d renewals", renewals)
+	}
+}
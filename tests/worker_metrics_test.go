@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestRunner_MetricsHandler(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+	api.addTask("task2", models.WorkerTypeVideo, []byte("hello"))
+	api.ignoreTypes = true
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+	)
+	server := httptest.NewServer(runner.MetricsHandler())
+	defer server.Close()
+
+	if status, _ := get(t, server.URL+"/readyz"); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready before the first poll, got %d", status)
+	}
+
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	time.Sleep(20 * time.Millisecond)
+	if status, _ := get(t, server.URL+"/readyz"); status != http.StatusOK {
+		t.Errorf("Expected ready while polling, got %d", status)
+	}
+	stop()
+
+	if status, _ := get(t, server.URL+"/healthz"); status != http.StatusOK {
+		t.Errorf("Expected healthy, got %d", status)
+	}
+	_, body := get(t, server.URL+"/metrics")
+	for _, want := range []string{
+		`qalpuch_worker_tasks_claimed_total{type="image"} 1`,
+		`qalpuch_worker_tasks_claimed_total{type="video"} 1`,
+		`qalpuch_worker_tasks_succeeded_total{type="image"} 1`,
+		`qalpuch_worker_tasks_failed_total{type="video"} 1`,
+		`qalpuch_worker_handler_duration_seconds_count{type="image"} 1`,
+		`qalpuch_worker_handler_duration_seconds_bucket{type="image",le="+Inf"} 1`,
+		"# TYPE qalpuch_worker_poll_duration_seconds histogram",
+		"qalpuch_worker_running_tasks 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func recordingMiddleware(name string, calls *[]string) worker.Middleware {
+	return func(next worker.Handler) worker.Handler {
+		return worker.HandlerFunc(func(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+			*calls = append(*calls, name)
+			return next.Handle(ctx, job)
+		})
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	h := worker.Chain(worker.HandlerFunc(func(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+		calls = append(calls, "handler")
+		return nil, nil
+	}), recordingMiddleware("outer", &calls), recordingMiddleware("inner", &calls))
+
+	if _, err := h.Handle(context.Background(), &worker.Job{}); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if want := []string{"outer", "inner", "handler"}; !slices.Equal(calls, want) {
+		t.Errorf("Expected calls %v, got %v", want, calls)
+	}
+}
+
+func TestRetry_TransientErrors(t *testing.T) {
+	noDelay := func() worker.Backoff { return worker.ConstantBackoff(0) }
+	errBusy := errors.New("device busy")
+
+	attempts := 0
+	h := worker.Chain(worker.HandlerFunc(func(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, worker.Transient(errBusy)
+		}
+		return &worker.Result{Filename: "out"}, nil
+	}), worker.Retry(3, noDelay))
+	if _, err := h.Handle(context.Background(), &worker.Job{}); err != nil || attempts != 3 {
+		t.Errorf("Expected success after 3 attempts, got %d attempts and error %v", attempts, err)
+	}
+
+	attempts = 0
+	h = worker.Chain(worker.HandlerFunc(func(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+		attempts++
+		return nil, errBusy
+	}), worker.Retry(3, noDelay))
+	if _, err := h.Handle(context.Background(), &worker.Job{}); !errors.Is(err, errBusy) || attempts != 1 {
+		t.Errorf("Expected a permanent error not to be retried, got %d attempts and error %v", attempts, err)
+	}
+}
+
+func TestRunner_AppliesMiddleware(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+
+	var calls []string
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithMiddleware(recordingMiddleware("mw", &calls)),
+		worker.WithPollInterval(10*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	if !slices.Equal(calls, []string{"mw"}) {
+		t.Errorf("Expected the middleware to wrap the handler once, got %v", calls)
+	}
+	if got := string(api.results["task1"]); got != "HELLO" {
+		t.Errorf("Expected result 'HELLO', got '%s'", got)
+	}
+}
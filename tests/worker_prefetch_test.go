@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// prefetchHandler reports that its first task is almost done, then waits for the
+// source of the next task to be downloaded before completing it.
+type prefetchHandler struct {
+	api *fakeWorkerAPI
+}
+
+func (h prefetchHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	if job.Task.ID != "task1" {
+		return &worker.Result{Filename: "out", Data: []byte(job.Task.ID)}, nil
+	}
+	job.Progress.Report(95, "finishing")
+	deadline := time.After(2 * time.Second)
+	for {
+		h.api.mu.Lock()
+		prefetched := slices.Contains(h.api.downloads, "src-task2")
+		h.api.mu.Unlock()
+		if prefetched {
+			return &worker.Result{Filename: "out", Data: []byte(job.Task.ID)}, nil
+		}
+		select {
+		case <-deadline:
+			return nil, errors.New("next source was not prefetched")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRunner_PrefetchesNextSource(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+	api.addTask("task2", models.WorkerTypeImage, []byte("b"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, prefetchHandler{api: api}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithPrefetch(90, 1<<20),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	stop()
+
+	for _, id := range []string{"task1", "task2"} {
+		if got := string(api.results[id]); got != id {
+			t.Errorf("Expected result '%s', got '%s' (status %+v)", id, got, api.lastStatus(id))
+		}
+	}
+}
+
+// leaseWaitHandler reports that its first task is almost done, then holds it until the lease of
+// the next task, which waits for the slot, has been renewed.
+type leaseWaitHandler struct {
+	api *fakeWorkerAPI
+}
+
+func (h leaseWaitHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	if job.Task.ID != "task1" {
+		return &worker.Result{Filename: "out", Data: []byte(job.Task.ID)}, nil
+	}
+	job.Progress.Report(95, "finishing")
+	deadline := time.After(2 * time.Second)
+	for {
+		h.api.mu.Lock()
+		renewed := h.api.renewals["task2"] > 0
+		h.api.mu.Unlock()
+		if renewed {
+			return &worker.Result{Filename: "out", Data: []byte(job.Task.ID)}, nil
+		}
+		select {
+		case <-deadline:
+			return nil, errors.New("lease of the waiting task was not renewed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestRunner_RenewsLeaseWhileWaitingForSlot(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+	api.addTask("task2", models.WorkerTypeImage, []byte("b"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, leaseWaitHandler{api: api}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithPrefetch(90, 1<<20),
+		worker.WithLeaseRenewal(10*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	stop()
+
+	if got := string(api.results["task1"]); got != "task1" {
+		t.Errorf("Expected the first task completed, got %q (status %+v)", got, api.lastStatus("task1"))
+	}
+	if first := api.statuses["task2"]; len(first) == 0 || first[0].Status != models.TaskStatusProcessing {
+		t.Errorf("Expected the waiting task reported as processing, got %+v", first)
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+type progressHandler struct{}
+
+func (progressHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	for i := range 100 {
+		job.Progress.Report(float64(i), fmt.Sprintf("frame %d", i))
+		time.Sleep(time.Millisecond)
+	}
+	return &worker.Result{Filename: "result.txt", Data: []byte("done")}, nil
+}
+
+func TestRunner_ThrottlesProgressUpdates(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, progressHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithProgressInterval(30*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	var updates []models.UpdateTaskStatusRequest
+	for _, status := range api.statuses["task1"] {
+		if status.Progress != nil {
+			updates = append(updates, status)
+		}
+	}
+	if len(updates) == 0 || len(updates) > 20 {
+		t.Fatalf("Expected a few coalesced progress updates, got %d", len(updates))
+	}
+	if last := updates[len(updates)-1]; *last.Progress != 99 || last.StatusMessage != "99% frame 99" {
+		t.Errorf("Expected the last update to be flushed, got %+v", last)
+	}
+}
+
+type nanProgressHandler struct{}
+
+func (nanProgressHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	job.Progress.Report(40, "decoding")
+	job.Progress.Report(math.NaN(), "encoding")
+	return &worker.Result{Filename: "result.txt", Data: []byte("done")}, nil
+}
+
+func TestRunner_IgnoresNaNProgress(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, nanProgressHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	var last *models.UpdateTaskStatusRequest
+	for _, status := range api.statuses["task1"] {
+		if status.Progress != nil {
+			last = &status
+		}
+	}
+	if last == nil || *last.Progress != 40 || last.StatusMessage != "40% encoding" {
+		t.Errorf("Expected the last valid percentage to be kept, got %+v", last)
+	}
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// thumbnailHandler writes its outputs into the job directory: the source in upper case and a thumbnail.
+type thumbnailHandler struct{}
+
+func (thumbnailHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	data, err := os.ReadFile(job.SourcePath)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(job.Dir, "video.mp4")
+	if err := os.WriteFile(path, []byte(strings.ToUpper(string(data))), 0o600); err != nil {
+		return nil, err
+	}
+	return &worker.Result{
+		Filename:    "video.mp4",
+		Path:        path,
+		Attachments: []worker.Output{{Filename: "thumb.jpg", Data: []byte("thumb")}},
+		Metadata:    &models.ResultMetadata{Duration: 3, Width: 320, Height: 240},
+	}, nil
+}
+
+func TestRunner_UploadsMultipleOutputs(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTaskWithConfig("task1", `{"type":"video"}`, []byte("clip"))
+	api.addTaskWithConfig("task2", `{"type":"video"}`, []byte("clip"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeVideo, thumbnailHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithResultCache(t.TempDir(), 1<<20),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	stop()
+
+	sum := sha256.Sum256([]byte("CLIP"))
+	for _, id := range []string{"task1", "task2"} {
+		if got := string(api.results[id]); got != "CLIP" {
+			t.Errorf("%s: expected the primary output 'CLIP', got '%s'", id, got)
+		}
+		if got := api.attachments[id]; len(got) != 1 || got[0] != "thumb.jpg" {
+			t.Errorf("%s: expected the thumbnail attachment, got %v", id, got)
+		}
+		metadata := api.metadata[id]
+		if metadata.Width != 320 || metadata.Height != 240 || metadata.Duration != 3 {
+			t.Errorf("%s: expected the handler metadata, got %+v", id, metadata)
+		}
+		if metadata.Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: expected the checksum of the primary output, got %q", id, metadata.Checksum)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/clients"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// fakeWorkerAPI is an in-memory implementation of the worker endpoints.
+type fakeWorkerAPI struct {
+	t        *testing.T
+	server   *httptest.Server
+	mu       sync.Mutex
+	pending  []models.Task
+	files    map[string][]byte
+	statuses map[string][]models.UpdateTaskStatusRequest
+	results  map[string][]byte
+	done     chan string
+
+	attachments map[string][]string // Filenames of the outputs uploaded after the primary one
+	metadata    map[string]models.ResultMetadata
+
+	heartbeats    []models.HeartbeatRequest
+	registrations int
+	downloads     []string
+	refreshes     int
+	lostLeases    map[string]bool
+	renewals      map[string]int
+
+	ignoreTypes bool // Serve tasks regardless of the requested types
+	noLogs      bool // Serve tasks without the logs of their past statuses
+	noLease     bool // Answer lease renewals as not found, like the documented API
+	noRefresh   bool // Register workers without a refresh token, like the documented API
+}
+
+func newFakeWorkerAPI(t *testing.T) *fakeWorkerAPI {
+	f := &fakeWorkerAPI{
+		t:        t,
+		files:    make(map[string][]byte),
+		statuses: make(map[string][]models.UpdateTaskStatusRequest),
+		results:  make(map[string][]byte),
+		done:     make(chan string, 100),
+
+		attachments: make(map[string][]string),
+		metadata:    make(map[string]models.ResultMetadata),
+
+		lostLeases: make(map[string]bool),
+		renewals:   make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/worker/register", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.registrations++
+		f.mu.Unlock()
+		if f.noRefresh {
+			f.respond(w, http.StatusOK, models.AuthWorkerResponseData{Token: "worker_jwt_token"})
+			return
+		}
+		f.respond(w, http.StatusOK, models.AuthWorkerResponseData{Token: "worker_jwt_token", RefreshToken: "worker_refresh_token"})
+	})
+	mux.HandleFunc("POST /v1/worker/refresh-auth", func(w http.ResponseWriter, r *http.Request) {
+		var req models.RefreshTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode refresh request: %v", err)
+		}
+		f.mu.Lock()
+		f.refreshes++
+		n := f.refreshes
+		f.mu.Unlock()
+		if !strings.HasPrefix(req.RefreshToken, "worker_refresh_token") {
+			f.fail(w, http.StatusUnauthorized, "Invalid refresh token")
+			return
+		}
+		f.respond(w, http.StatusOK, models.AuthWorkerResponseData{
+			Token:        fmt.Sprintf("worker_jwt_token_%d", n),
+			RefreshToken: fmt.Sprintf("worker_refresh_token_%d", n),
+		})
+	})
+	mux.HandleFunc("POST /v1/worker/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		var req models.HeartbeatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode heartbeat: %v", err)
+		}
+		f.mu.Lock()
+		f.heartbeats = append(f.heartbeats, req)
+		f.mu.Unlock()
+		f.respond(w, http.StatusOK, nil)
+	})
+	mux.HandleFunc("GET /v1/tasks/pending", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.pending) == 0 {
+			f.fail(w, http.StatusNotFound, "No pending task")
+			return
+		}
+		for i, task := range f.pending {
+			workerType, _ := task.ConversionType()
+			if types := r.URL.Query().Get("types"); types != "" && !f.ignoreTypes && !slices.Contains(strings.Split(types, ","), string(workerType)) {
+				continue
+			}
+			f.pending = slices.Delete(f.pending, i, i+1)
+			if !f.noLogs {
+				for j, status := range f.statuses[task.ID] {
+					task.Logs = append(task.Logs, models.Log{ID: fmt.Sprint(j), TaskID: task.ID, TaskStatus: status.Status, Message: status.StatusMessage})
+				}
+			}
+			f.respond(w, http.StatusOK, task)
+			return
+		}
+		f.fail(w, http.StatusNotFound, "No pending task")
+	})
+	mux.HandleFunc("GET /v1/files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		data, ok := f.files[r.PathValue("id")]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "File not found")
+			return
+		}
+		f.respond(w, http.StatusOK, models.File{ID: r.PathValue("id"), Filename: "source.bin", Size: int64(len(data)), Hash: fmt.Sprintf("%x", sha256.Sum256(data))})
+	})
+	mux.HandleFunc("GET /v1/files/{id}/download", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.downloads = append(f.downloads, r.PathValue("id"))
+		if _, err := w.Write(f.files[r.PathValue("id")]); err != nil {
+			t.Error(err)
+		}
+	})
+	mux.HandleFunc("PATCH /v1/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req models.UpdateTaskStatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode status update: %v", err)
+		}
+		f.mu.Lock()
+		f.statuses[r.PathValue("id")] = append(f.statuses[r.PathValue("id")], req)
+		f.mu.Unlock()
+		if req.Status == models.TaskStatusFailed || req.Status == models.TaskStatusPending {
+			f.done <- r.PathValue("id")
+		}
+		f.respond(w, http.StatusOK, nil)
+	})
+	mux.HandleFunc("POST /v1/tasks/{id}/lease", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.renewals[r.PathValue("id")]++
+		if f.noLease {
+			f.fail(w, http.StatusNotFound, "Not found")
+			return
+		}
+		if f.lostLeases[r.PathValue("id")] {
+			f.fail(w, http.StatusConflict, "Task is assigned to another worker")
+			return
+		}
+		f.respond(w, http.StatusOK, models.TaskLease{TaskID: r.PathValue("id"), ExpiresAt: time.Now().Add(time.Minute)})
+	})
+	mux.HandleFunc("POST /v1/tasks/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("Failed to read result file: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		f.mu.Lock()
+		f.results[r.PathValue("id")] = data
+		for _, header := range r.MultipartForm.File["file"][1:] {
+			f.attachments[r.PathValue("id")] = append(f.attachments[r.PathValue("id")], header.Filename)
+		}
+		if value := r.FormValue("metadata"); value != "" {
+			var metadata models.ResultMetadata
+			if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+				t.Errorf("Failed to decode result metadata: %v", err)
+			}
+			f.metadata[r.PathValue("id")] = metadata
+		}
+		f.mu.Unlock()
+		f.respond(w, http.StatusOK, models.File{ID: "result-" + r.PathValue("id")})
+		f.done <- r.PathValue("id")
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeWorkerAPI) respond(w http.ResponseWriter, status int, data interface{}) {
+	w.WriteHeader(status)
+	resp := models.APIResponse{Success: true}
+	if data != nil {
+		resp.Data = &data
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		f.t.Error(err)
+	}
+}
+
+func (f *fakeWorkerAPI) fail(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(models.APIErrorResponse{Success: false, Message: message}); err != nil {
+		f.t.Error(err)
+	}
+}
+
+// addTask queues a pending task whose source file holds source.
+func (f *fakeWorkerAPI) addTask(id string, workerType models.WorkerType, source []byte) {
+	f.addTaskWithConfig(id, `{"type":"`+string(workerType)+`"}`, source)
+}
+
+// addTaskWithConfig queues a pending task with the given configuration.
+func (f *fakeWorkerAPI) addTaskWithConfig(id, config string, source []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sourceID := "src-" + id
+	f.files[sourceID] = source
+	f.pending = append(f.pending, models.Task{
+		ID:           id,
+		Config:       config,
+		Status:       models.TaskStatusProcessing,
+		SourceFileID: &sourceID,
+	})
+}
+
+func (f *fakeWorkerAPI) client(token string) *clients.Client {
+	return clients.NewClient(f.server.URL+"/v1", token)
+}
+
+func (f *fakeWorkerAPI) lastStatus(id string) models.UpdateTaskStatusRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	statuses := f.statuses[id]
+	if len(statuses) == 0 {
+		return models.UpdateTaskStatusRequest{}
+	}
+	return statuses[len(statuses)-1]
+}
+
+// waitDone waits until n tasks have been completed or failed.
+func (f *fakeWorkerAPI) waitDone(n int) []string {
+	f.t.Helper()
+	var ids []string
+	timeout := time.After(5 * time.Second)
+	for len(ids) < n {
+		select {
+		case id := <-f.done:
+			ids = append(ids, id)
+		case <-timeout:
+			f.t.Fatalf("Timed out waiting for %d tasks, got %v", n, ids)
+		}
+	}
+	return ids
+}
+
+// runWorker starts the runner in the background and returns a function stopping it.
+func runWorker(t *testing.T, runner *worker.Runner) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- runner.Run(ctx) }()
+	return func() {
+		cancel()
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Errorf("Run returned an error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Runner did not stop")
+		}
+	}
+}
+
+type upperHandler struct{}
+
+func (upperHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	data, err := os.ReadFile(job.SourcePath)
+	if err != nil {
+		return nil, err
+	}
+	for i, b := range data {
+		if b >= 'a' && b <= 'z' {
+			data[i] = b - 'a' + 'A'
+		}
+	}
+	return &worker.Result{Filename: "result.txt", Data: data}, nil
+}
+
+func TestRunner_ProcessesPendingTask(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+
+	runner := worker.NewRunner(api.client(""),
+		worker.WithRegistrationToken("registration-token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(10*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	if got := string(api.results["task1"]); got != "HELLO" {
+		t.Errorf("Expected result 'HELLO', got '%s'", got)
+	}
+}
+
+func TestRunner_FailsTaskWithoutHandler(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.ignoreTypes = true
+	api.addTask("task1", models.WorkerTypeVideo, []byte("video"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(10*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusFailed {
+		t.Errorf("Expected task to be failed, got %+v", status)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &worker.ExponentialBackoff{Min: time.Second, Max: 4 * time.Second}
+
+	var delays []time.Duration
+	for range 4 {
+		delays = append(delays, b.Next())
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i := range expected {
+		if delays[i] != expected[i] {
+			t.Errorf("Expected delays %v, got %v", expected, delays)
+			break
+		}
+	}
+
+	b.Reset()
+	if d := b.Next(); d != time.Second {
+		t.Errorf("Expected delay to restart at 1s, got %v", d)
+	}
+}
+
+// concurrencyHandler records how many of its tasks run at the same time.
+type concurrencyHandler struct {
+	running atomic.Int32
+	peak    atomic.Int32
+	delay   time.Duration
+}
+
+func (h *concurrencyHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	n := h.running.Add(1)
+	defer h.running.Add(-1)
+	for peak := h.peak.Load(); n > peak && !h.peak.CompareAndSwap(peak, n); peak = h.peak.Load() {
+	}
+	time.Sleep(h.delay)
+	return &worker.Result{Filename: "result.txt", Data: []byte(job.Task.ID)}, nil
+}
+
+func TestRunner_RespectsTypeLimits(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("img1", models.WorkerTypeImage, []byte("a"))
+	api.addTask("img2", models.WorkerTypeImage, []byte("b"))
+	api.addTask("img3", models.WorkerTypeImage, []byte("c"))
+	api.addTask("vid1", models.WorkerTypeVideo, []byte("d"))
+
+	images := &concurrencyHandler{delay: 50 * time.Millisecond}
+	videos := &concurrencyHandler{delay: 50 * time.Millisecond}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, images),
+		worker.WithHandler(models.WorkerTypeVideo, videos),
+		worker.WithConcurrency(3),
+		worker.WithTypeLimit(models.WorkerTypeImage, 2),
+		worker.WithTypeFilter(),
+		worker.WithPollInterval(5*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(4)
+	stop()
+
+	if peak := images.peak.Load(); peak != 2 {
+		t.Errorf("Expected at most 2 concurrent image tasks, got %d", peak)
+	}
+	if len(api.results) != 4 {
+		t.Errorf("Expected 4 results, got %d", len(api.results))
+	}
+}
+
+// gateHandler holds every task until release is closed.
+type gateHandler struct {
+	started chan string
+	release chan struct{}
+}
+
+func (h *gateHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	h.started <- job.Task.ID
+	<-h.release
+	return &worker.Result{Filename: "result.txt", Data: []byte("done")}, nil
+}
+
+func TestRunner_KeepsPollingWhileATypeIsFull(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.ignoreTypes = true // Like an API which does not filter pending tasks by type
+	api.addTask("img1", models.WorkerTypeImage, []byte("a"))
+	api.addTask("img2", models.WorkerTypeImage, []byte("b"))
+	api.addTask("vid1", models.WorkerTypeVideo, []byte("c"))
+
+	images := &gateHandler{started: make(chan string, 2), release: make(chan struct{})}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, images),
+		worker.WithHandler(models.WorkerTypeVideo, upperHandler{}),
+		worker.WithConcurrency(2),
+		worker.WithTypeLimit(models.WorkerTypeImage, 1),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+	)
+	stop := runWorker(t, runner)
+	<-images.started
+	// The second image is handed back and the video runs next to the first image.
+	api.waitDone(2)
+	close(images.release)
+	api.waitDone(1)
+	stop()
+
+	if status := api.lastStatus("img2"); status.Status != models.TaskStatusPending || !strings.Contains(status.StatusMessage, "no free slot") {
+		t.Errorf("Expected the second image handed back, got %+v", status)
+	}
+	if got := string(api.results["vid1"]); got != "C" {
+		t.Errorf("Expected the video processed while the image slot is busy, got %q", got)
+	}
+}
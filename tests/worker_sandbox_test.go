@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func sandboxedHandler(t *testing.T, script string, sandbox *worker.Sandbox) *worker.ExecHandler {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox limits are only supported on Linux")
+	}
+	h := worker.NewExecHandler("sh", "-c", script)
+	h.Sandbox = sandbox
+	return h
+}
+
+func TestSandbox_ScrubsEnvironment(t *testing.T) {
+	t.Setenv("QALPUCH_SECRET", "s3cr3t")
+	job := execJob(t, nil)
+	script := `env > env.txt; echo '{"type":"result","path":"env.txt"}'`
+	h := sandboxedHandler(t, script, &worker.Sandbox{Env: []string{"LANG=C"}})
+
+	result, err := h.Handle(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	env := readOutput(t, result.Data, result.Path)
+	if strings.Contains(env, "QALPUCH_SECRET") || !strings.Contains(env, "LANG=C") {
+		t.Errorf("Expected a scrubbed environment, got:\n%s", env)
+	}
+	if dirs, _ := filepath.Glob(filepath.Join(job.Dir, "sandbox-*")); len(dirs) != 0 {
+		t.Errorf("Expected the sandbox directory to be removed, found %v", dirs)
+	}
+	if filepath.Dir(result.Path) != job.Dir {
+		t.Errorf("Expected the output to be kept in the job directory, got %s", result.Path)
+	}
+}
+
+func TestSandbox_FileSizeLimit(t *testing.T) {
+	job := execJob(t, nil)
+	h := sandboxedHandler(t, "exec head -c 100000 /dev/zero > big", &worker.Sandbox{FileSize: 1024})
+
+	_, err := h.Handle(context.Background(), job)
+	var limitErr *worker.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Resource != "file size" {
+		t.Fatalf("Expected a file size LimitError, got %v", err)
+	}
+}
+
+func TestSandbox_LimitsAppliedBeforeExec(t *testing.T) {
+	job := execJob(t, nil)
+	// The limits are already in place when the first instruction of the command runs.
+	h := sandboxedHandler(t, `ulimit -n > limits.txt; ulimit -v >> limits.txt; echo '{"type":"result","path":"limits.txt"}'`,
+		&worker.Sandbox{OpenFiles: 32, AddressSpace: 1 << 30})
+
+	result, err := h.Handle(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if got := readOutput(t, result.Data, result.Path); got != "32\n1048576\n" {
+		t.Errorf("Expected the open files and address space limits, got %q", got)
+	}
+}
+
+func TestSandbox_CPUTimeLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("burns one second of CPU")
+	}
+	job := execJob(t, nil)
+	h := sandboxedHandler(t, "while :; do :; done", &worker.Sandbox{CPUTime: time.Second})
+	h.Timeout = 10 * time.Second
+
+	_, err := h.Handle(context.Background(), job)
+	var limitErr *worker.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Resource != "cpu time" {
+		t.Fatalf("Expected a cpu time LimitError, got %v", err)
+	}
+}
+
+func TestSandbox_RunsAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+	job := execJob(t, nil)
+	// The parent created by the testing package is only traversable by root.
+	if err := os.Chmod(filepath.Dir(job.Dir), 0o711); err != nil {
+		t.Fatal(err)
+	}
+	script := `cat "$(sed 's/.*"sourcePath":"\([^"]*\)".*/\1/')" > copy.txt; id -u >> copy.txt; id -G >> copy.txt; echo '{"type":"result","path":"copy.txt"}'`
+	h := sandboxedHandler(t, script, &worker.Sandbox{User: &worker.SandboxUser{UID: 65534, GID: 65534}})
+
+	result, err := h.Handle(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if got := readOutput(t, result.Data, result.Path); got != "hello65534\n65534\n" {
+		t.Errorf("Expected the source to be readable by uid 65534 without other groups, got %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+// blockingHandler signals when it starts, then works for delay or until its context is done.
+type blockingHandler struct {
+	started chan struct{}
+	delay   time.Duration
+	cause   chan error
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	close(h.started)
+	select {
+	case <-time.After(h.delay):
+		return &worker.Result{Filename: "result.txt", Data: []byte("done")}, nil
+	case <-ctx.Done():
+		h.cause <- context.Cause(ctx)
+		return nil, ctx.Err()
+	}
+}
+
+func TestRunner_DrainsRunningTasksOnShutdown(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	h := &blockingHandler{started: make(chan struct{}), delay: 50 * time.Millisecond, cause: make(chan error, 1)}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithShutdownGrace(time.Second),
+	)
+	stop := runWorker(t, runner)
+	<-h.started
+	stop()
+
+	if got := string(api.results["task1"]); got != "done" {
+		t.Errorf("Expected the running task to complete during the grace period, got result '%s'", got)
+	}
+}
+
+func TestRunner_HandsBackTasksAfterGracePeriod(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	h := &blockingHandler{started: make(chan struct{}), delay: time.Hour, cause: make(chan error, 1)}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithShutdownGrace(20*time.Millisecond),
+		worker.WithHandBackStatus(models.TaskStatusPending),
+	)
+	stop := runWorker(t, runner)
+	<-h.started
+	stop()
+
+	if cause := <-h.cause; !errors.Is(cause, worker.ErrShutdown) {
+		t.Errorf("Expected handler to be cancelled with ErrShutdown, got %v", cause)
+	}
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusPending {
+		t.Errorf("Expected task to be handed back as pending, got %+v", status)
+	}
+	if _, ok := api.results["task1"]; ok {
+		t.Error("Expected no result for an interrupted task")
+	}
+}
+
+// progressingHandler reports its progress twice, the second update staying pending, then blocks until
+// cancelled and returns once the task has been handed back.
+type progressingHandler struct {
+	started chan struct{}
+}
+
+func (h *progressingHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	job.Progress.Report(10, "decoding")
+	time.Sleep(10 * time.Millisecond) // Sent right away, starting the progress interval
+	job.Progress.Report(50, "encoding")
+	close(h.started)
+	<-ctx.Done()
+	time.Sleep(20 * time.Millisecond)
+	return nil, ctx.Err()
+}
+
+func TestRunner_HandBackIsNotOverriddenByPendingProgress(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+
+	h := &progressingHandler{started: make(chan struct{})}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithProgressInterval(time.Hour),
+		worker.WithShutdownGrace(20*time.Millisecond),
+		worker.WithHandBackStatus(models.TaskStatusPending),
+	)
+	stop := runWorker(t, runner)
+	<-h.started
+	stop()
+
+	if status := api.lastStatus("task1"); status.Status != models.TaskStatusPending {
+		t.Errorf("Expected the hand-back to be the last status, got %+v", status)
+	}
+}
@@ -49,6 +49,9 @@ func TestWorkerClient_RegisterWorker(t *testing.T) {
 	if resp.Data.Token != "worker_jwt_token" {
 		t.Errorf("Expected token 'worker_jwt_token', got %s", resp.Data.Token)
 	}
+	if resp.Message != "Worker authenticated successfully" {
+		t.Errorf("Expected the message of the API, got %q", resp.Message)
+	}
 }
 
 func TestWorkerClient_CreateWorker(t *testing.T) {
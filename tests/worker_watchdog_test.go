@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+type panicHandler struct{}
+
+func (panicHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	panic("corrupted frame")
+}
+
+func TestRunner_RecoversHandlerPanic(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("a"))
+	api.addTask("task2", models.WorkerTypeImage, []byte("b"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, panicHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	stop()
+
+	status := api.lastStatus("task1")
+	if status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "handler panicked: corrupted frame") {
+		t.Errorf("Expected task to fail with the panic value, got %+v", status)
+	}
+	if !strings.Contains(status.StatusMessage, "tests.panicHandler.Handle (worker_watchdog_test.go:") {
+		t.Errorf("Expected the message to name the function that panicked, got %q", status.StatusMessage)
+	}
+	if strings.Contains(status.StatusMessage, "goroutine") {
+		t.Errorf("Expected no stack in the status message, got %q", status.StatusMessage)
+	}
+}
+
+func TestRunner_FailsTaskAfterDeadline(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeVideo, []byte("a"))
+
+	h := &blockingHandler{started: make(chan struct{}), delay: time.Hour, cause: make(chan error, 1)}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeVideo, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithDefaultTaskTimeout(time.Hour),
+		worker.WithTaskTimeout(models.WorkerTypeVideo, 20*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	status := api.lastStatus("task1")
+	if status.Status != models.TaskStatusFailed || !strings.Contains(status.StatusMessage, "task deadline exceeded after 20ms") {
+		t.Errorf("Expected task to fail on its deadline, got %+v", status)
+	}
+}
+
+// stubbornHandler ignores the cancellation of its context until after the abandon delay.
+type stubbornHandler struct {
+	running    atomic.Int32
+	overlapped atomic.Bool
+	lostDir    atomic.Bool
+}
+
+func (h *stubbornHandler) Handle(ctx context.Context, job *worker.Job) (*worker.Result, error) {
+	if h.running.Add(1) > 1 {
+		h.overlapped.Store(true)
+	}
+	defer h.running.Add(-1)
+	if job.Task.ID != "stubborn" {
+		return &worker.Result{Filename: "result.txt", Data: []byte("done")}, nil
+	}
+	time.Sleep(5*time.Second + 300*time.Millisecond)
+	if _, err := os.Stat(job.Dir); err != nil {
+		h.lostDir.Store(true)
+	}
+	return nil, ctx.Err()
+}
+
+func TestRunner_KeepsSlotOfAbandonedHandler(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("stubborn", models.WorkerTypeVideo, []byte("a"))
+	api.addTask("next", models.WorkerTypeVideo, []byte("b"))
+
+	h := &stubbornHandler{}
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeVideo, h),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithTaskTimeout(models.WorkerTypeVideo, 20*time.Millisecond),
+	)
+	stop := runWorker(t, runner)
+	time.Sleep(3 * time.Second) // The handler is only abandoned after 5s, longer than waitDone waits
+	api.waitDone(2)
+	stop()
+
+	if status := api.lastStatus("stubborn"); status.Status != models.TaskStatusFailed {
+		t.Errorf("Expected the abandoned task to fail, got %+v", status)
+	}
+	if h.overlapped.Load() {
+		t.Error("Expected the next task to wait for the abandoned handler to return")
+	}
+	if h.lostDir.Load() {
+		t.Error("Expected the directory of the abandoned handler to be kept until it returns")
+	}
+}
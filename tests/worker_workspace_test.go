@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/models"
+	"github.com/Q300Z/go_sdk_qalpuch_api/pkg/worker"
+)
+
+func TestRunner_EnforcesDiskQuota(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("big", models.WorkerTypeImage, []byte(strings.Repeat("a", 20)))
+	api.addTask("small", models.WorkerTypeImage, []byte("abc"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithDiskQuota(10),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(2)
+	stop()
+
+	status := api.lastStatus("big")
+	if status.Status != models.TaskStatusPending || !strings.Contains(status.StatusMessage, "insufficient disk space") {
+		t.Errorf("Expected the task exceeding the quota to be handed back, got %+v", status)
+	}
+	if got := string(api.results["small"]); got != "ABC" {
+		t.Errorf("Expected result 'ABC', got '%s'", got)
+	}
+}
+
+func TestRunner_DoesNotClaimBelowMinFreeSpace(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(t.TempDir()),
+		worker.WithMinFreeSpace(1<<62),
+	)
+	stop := runWorker(t, runner)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.pending) != 1 || len(api.statuses["task1"]) != 0 {
+		t.Errorf("Expected the task left unclaimed, got %d pending and statuses %+v", len(api.pending), api.statuses["task1"])
+	}
+}
+
+func TestRunner_CleansWorkDir(t *testing.T) {
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "task-stale")
+	if err := os.MkdirAll(stale, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	keep := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(keep, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := worker.NewRunner(api.client("test_token"),
+		worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+		worker.WithPollInterval(5*time.Millisecond),
+		worker.WithWorkDir(dir),
+	)
+	stop := runWorker(t, runner)
+	api.waitDone(1)
+	stop()
+
+	if tasks, _ := filepath.Glob(filepath.Join(dir, "task-*")); len(tasks) != 0 {
+		t.Errorf("Expected no task directory to remain, got %v", tasks)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("Expected unrelated files to be kept: %v", err)
+	}
+}
+
+func TestRunner_RefusesSharedWorkDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("work directories are not locked on this platform")
+	}
+	api := newFakeWorkerAPI(t)
+	api.addTask("task1", models.WorkerTypeImage, []byte("hello"))
+	dir := t.TempDir()
+	newRunner := func() *worker.Runner {
+		return worker.NewRunner(api.client("test_token"),
+			worker.WithHandler(models.WorkerTypeImage, upperHandler{}),
+			worker.WithPollInterval(5*time.Millisecond),
+			worker.WithWorkDir(dir),
+		)
+	}
+	stop := runWorker(t, newRunner())
+	api.waitDone(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := newRunner().Run(ctx); err == nil || !strings.Contains(err.Error(), "used by another worker") {
+		t.Errorf("Expected a second worker to be refused the work directory, got %v", err)
+	}
+	stop()
+
+	// The lock is released when the first worker stops.
+	stop = runWorker(t, newRunner())
+	stop()
+}